@@ -2,167 +2,444 @@
 (https://dwc.tdwg.org/simple/) compatibility.
 
 Run DWCHelper with two command-line arguments, the first being the
-input file and the second being the output file.  */
+input file and the second being the output file. Options go before
+the file names; run DWCHelper -h to list them. With -merge, several
+input files are combined into the output file.  */
 package main
 
 import (        
 	"encoding/csv"
+	"flag"
 	"fmt"
-	"runtime"
+	"io"
 	"os"
 	"io/ioutil"
 	"net/http"
 	"strings"
 	"strconv"
+	"time"
 )
 
 
 
 const aliasURL = "https://git.sr.ht/~wrycode/DWCHelper/blob/master/aliases.csv"
 
-func main() {
-	// Check for filename argument
-	if len(os.Args) != 3 {
-		fmt.Println("Usage: DWCHelper <input-filename.csv> <output-filename.csv>")
-		os.Exit(1)
-	}
+// command-line options
+var (
+	encodingFlag          = flag.String("encoding", "auto", "character `encoding` of the input file, such as utf-8, utf-16le or windows-1252")
+	delimiterFlag         = flag.String("delimiter", "", "field `separator` of the input file: comma, semicolon, tab, pipe or a single character (default: detect)")
+	quoteFlag             = flag.String("quote", "", "quote `character` of the input file, \" or ' (default: detect)")
+	sheetFlag             = flag.String("sheet", "", "`name` of the sheet to read from an .xlsx or .ods workbook (default: ask)")
+	raggedFlag            = flag.String("ragged", "pad", "what to do with rows that have the wrong number of fields: pad short rows, truncate long ones, or reject them (rows that can't be fixed go to <output>.rejects.csv)")
+	headerRowFlag         = flag.Int("header-row", 0, "`row` of the input that holds the column names; rows above it are skipped (default: detect)")
+	headerRowsFlag        = flag.Int("header-rows", 1, "`number` of rows, ending with -header-row, to join into the column names")
+	mergeFlag             = flag.Bool("merge", false, "combine several input files, each converted with its own settings, into one output file")
+	formatFlag            = flag.String("format", "", "output `format`: csv, dwca for a Darwin Core Archive, sqlite for a database, or turtle, ntriples or jsonld for linked data (default: from the output file extension: .zip, .sqlite, .ttl, .nt or .jsonld)")
+	namespaceFlag         = flag.String("namespace", "", "`IRI` of the namespace for columns that aren't Darwin Core terms in linked data output (default: http://example.org/<output name>/)")
+	sourceFlag            = flag.String("source", "datasetName", "`term` that records which input file each row came from when merging (empty for none)")
+	outputDelimiterFlag   = flag.String("output-delimiter", "comma", "field `separator` of the output: comma, semicolon, tab, pipe or a single character")
+	lineEndingFlag        = flag.String("line-ending", "lf", "line `ending` of the output: lf or crlf")
+	quotingFlag           = flag.String("quoting", quoteMinimal, "which output fields to quote: minimal (only those that need it) or all")
+	bomFlag               = flag.Bool("bom", false, "start the output with a UTF-8 byte order mark, which some versions of Excel need")
+	headerCaseFlag        = flag.String("header-case", caseKeep, "`case` of the output column names: keep, lower or upper")
+	orderFlag             = flag.String("order", orderInput, "`order` of the output columns: input, dwc (Darwin Core terms in the official order, grouped by class, then the other columns) or dwc-only (leave the other columns out)")
+	packFlag              = flag.String("dynamic-properties", packOff, "pack the columns that aren't Darwin Core terms into dynamicProperties as JSON, with keys named as the columns are (keep), in camel case (camel) or in snake case (snake), or don't (off)")
+	partitionFlag         = flag.String("partition", "", "`term` to split the output by, writing one file per value and a manifest of the files")
+	partitionTemplateFlag = flag.String("partition-template", defaultPartitionTemplate, "file name `template` for -partition, from {name} and {ext} of the output file, {term} and {value}")
+	dryRunFlag            = flag.Bool("dry-run", false, "show what the conversion would do (removals, renames, the output header, the first rows and a summary of each column) without writing any files")
+	previewFlag           = flag.Int("preview", 5, "`number` of converted rows to show with -dry-run")
+	emlFlag               = flag.Bool("eml", false, "ask for the dataset metadata (title, creators, license...) that publishing needs, and write it as EML with the output")
+	migrateFlag           = flag.Bool("migrate", false, "rewrite the .settings files given as arguments, from before version 1, in the current JSON format, and exit")
+	profileFlag           = flag.String("profile", "", "`name` of a saved profile to convert the input with, instead of its .settings file; a new profile is made from the answers to the prompts")
+	saveProfileFlag       = flag.String("save-profile", "", "save the settings of the (first) input as the profile `name`, replacing any profile of that name")
+	strictFlag            = flag.Bool("strict", false, "stop, without writing or saving anything, if the settings remove or rename columns the input doesn't have, rename columns to names that aren't Darwin Core terms, or give two columns the same name")
+)
 
-	// Import database from file given as first command-line argument
-	db := importDB(os.Args[1])
+// fetchClient fetches the term and alias lists, giving up quickly on a
+// poor connection so that the built-in lists are used instead
+var fetchClient = &http.Client{Timeout: 10 * time.Second}
 
-	// check for .settings file, if it exists, apply the saved
-	// settings.  Otherwise, run the helper functions
+// joinFlag collects the tables given with -join
+var joinFlag joinList
 
-	f, err := os.Open(os.Args[1] + ".settings")
-	defer f.Close()
-	if err == nil {
-		Prompt(false,`Using settings from previous run. To run with
-clean options and redo the import process, please` +
-	"delete " + os.Args[1] + ".settings "+ " and re-run DWCHelper...")
+func init() {
+	flag.Var(&joinFlag, "join", "table to join to the input on a key column before converting it, such as an Access export of sites, given as `file[:column[=column]]` (may be repeated)")
+}
 
-		r := csv.NewReader(f)
-		r.LazyQuotes = true
-		
-		// .settings file is not "square"
-		r.FieldsPerRecord = -1
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), `Usage: DWCHelper [options] <input-filename.csv|.xlsx|.ods> <output-filename.csv>
+       DWCHelper -merge [options] <input-filename> <input-filename>... <output-filename.csv>
+       DWCHelper -migrate <settings-file>...`)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-		// remove terms
-		termsToRemove, err := r.Read()
-		if err != nil {
-			fmt.Println("Cannot read CSV data for terms to remove in the settings file:", err.Error())
+	if *migrateFlag {
+		if flag.NArg() == 0 {
+			flag.Usage()
 			os.Exit(1)
 		}
-		
-		for _, val := range termsToRemove {
-			db = removeTerm(val, db)
-		}
+		migrateSettings(flag.Args())
+		return
+	}
 
-		// rename the rest
-		rows, err := r.ReadAll()
-		if err != nil {
-			fmt.Println("Cannot read CSV data for aliases in the settings file:", err.Error())
+	// Check for filename argument
+	if (*mergeFlag && flag.NArg() < 3) || (!*mergeFlag && flag.NArg() != 2) {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputs, output := flag.Args()[:flag.NArg()-1], flag.Arg(flag.NArg()-1)
+
+	// the dialect given on the command line wins over the saved
+	// one, and anything left is detected from the file
+	var given inputDialect
+	var err error
+	given.encoding = *encodingFlag
+	if *delimiterFlag != "" {
+		if given.delimiter, err = parseDelimiter(*delimiterFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *quoteFlag != "" {
+		if given.quote, err = parseQuote(*quoteFlag); err != nil {
+			fmt.Println(err)
 			os.Exit(1)
 		}
+	}
+	given.sheet = *sheetFlag
+	if !Include(raggedStrategies, *raggedFlag) {
+		fmt.Printf("-ragged must be one of %v\n", strings.Join(raggedStrategies, ", "))
+		os.Exit(1)
+	}
+	given.ragged = *raggedFlag
+	if *formatFlag != "" && !Include(outputFormats, *formatFlag) {
+		fmt.Printf("-format must be one of %v\n", strings.Join(outputFormats, ", "))
+		os.Exit(1)
+	}
+	if !strings.Contains(*partitionTemplateFlag, "{value}") {
+		fmt.Println("-partition-template must contain {value}, or every file would have the same name")
+		os.Exit(1)
+	}
+	if *namespaceFlag != "" && !strings.Contains(*namespaceFlag, ":") {
+		fmt.Println("-namespace must be an IRI, such as http://example.org/olduvai/")
+		os.Exit(1)
+	}
+	given.headerRow, given.headerRows = *headerRowFlag, *headerRowsFlag
+	if given.headerRows < 1 || (given.headerRow > 0 && given.headerRows > given.headerRow) {
+		fmt.Println("-header-rows must be between 1 and -header-row")
+		os.Exit(1)
+	}
+	given.joins = joinFlag
+	for _, name := range []string{*profileFlag, *saveProfileFlag} {
+		if err := checkProfileName(name); name != "" && err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+	if *profileFlag != "" {
+		if _, err := os.Stat(profilePath(*profileFlag)); err != nil {
+			fmt.Printf("There is no profile named \"%v\" yet; it will be made from your answers\n", *profileFlag)
+			if names := profileNames(); len(names) > 0 {
+				fmt.Println("The profiles are:", strings.Join(names, ", "))
+			}
+		}
+	}
 
-		for _, row := range rows {
-			alias := row[0]
-			newTerm := row[1]
-			db = renameTerm(alias, newTerm, db)
+	// output options given on the command line are saved with the
+	// settings, so the output comes out the same next time
+	var outputGiven [][]string
+	flag.Visit(func(f *flag.Flag) {
+		if Include(outputOptions, f.Name) {
+			outputGiven = append(outputGiven, []string{f.Name, f.Value.String()})
 		}
-	} else {
-		// CSV writer to save the settings in the file
-		settingsFile, err := os.Create(os.Args[1] + ".settings")
-		var w *csv.Writer
-		if err != nil {
-			fmt.Printf("Cannot save settings to '%s': %s\n", os.Args[1] + ".settings", err.Error())
-			fmt.Println("Proceeding without saving your conversion settings...")
-			w = csv.NewWriter(ioutil.Discard)
-		} else {
-			w = csv.NewWriter(settingsFile)
+	})
+	var check outputDialect
+	for _, o := range outputGiven {
+		if err := check.set(o[0], o[1]); err != nil {
+			fmt.Printf("-%v: %v\n", o[0], err.Error())
+			os.Exit(1)
 		}
+	}
 
-		// fix windows line endings
-		if runtime.GOOS == "windows" {
-			w.UseCRLF = true
+	// the Darwin Core terms are fetched once, for everything below,
+	// and so are the aliases for the rename suggestions
+	DWCTerms := pullDWCTerms()
+	aliases := pullAliases()
+
+	var all []settings
+	var changed []bool
+	for _, input := range inputs {
+		s, save := prepareInput(input, given, DWCTerms, aliases)
+		if len(outputGiven) > 0 {
+			for _, o := range outputGiven {
+				s.output.set(o[0], o[1])
+			}
+			save = true
 		}
+		all = append(all, s)
+		changed = append(changed, save)
+	}
 
-		// remove terms
-		termsToRemove := removeHelper(db)
-		for _, val := range termsToRemove {
-			db = removeTerm(val, db)
+	// check the settings against the columns of each input before
+	// anything is written
+	problems := false
+	for i, input := range inputs {
+		f, header, _ := openTable(input, all[i].dialect, "")
+		f.Close()
+		if reportSettings(settingsPath(input), header, all[i], DWCTerms) {
+			problems = true
 		}
+	}
+	if problems && *strictFlag {
+		fmt.Println("Stopping because of -strict; fix the settings and run DWCHelper again")
+		os.Exit(1)
+	}
 
-		// save removed terms
-		w.Write(termsToRemove)
+	// the settings are saved once they have passed the check, and a
+	// dry run doesn't save them at all
+	if !*dryRunFlag {
+		for i, input := range inputs {
+			if !changed[i] {
+				continue
+			}
+			saveInputSettings(input, all[i])
+			// settings from before the JSON format are upgraded in place
+			if all[i].legacy {
+				fmt.Printf("Upgraded %v to settings version %v\n", settingsPath(input), settingsVersion)
+			}
+		}
+		if *saveProfileFlag != "" {
+			saveProfile(*saveProfileFlag, all[0])
+		}
+	}
 
-		// rename terms
-		rows := renameHelper(db)
-		for _, row := range rows {
-			alias := row[0]
-			DWCTerm := row[1]
-			db = renameTerm(alias, DWCTerm, db)
+	if *namespaceFlag != "" {
+		for i := range all {
+			all[i].namespace = *namespaceFlag
 		}
+	}
 
-		// save renamed terms
-		w.WriteAll(rows)
-		w.Flush()
+	// the dataset metadata is kept with the (first) input's settings
+	if *emlFlag && !all[0].meta.complete() {
+		meta, err := metadataHelper(all[0].meta, os.Stdin)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		all[0].meta = meta
+		if !*dryRunFlag {
+			saveInputSettings(inputs[0], all[0])
+		}
 	}
 
-	// Export database to file given as second command-line argument
-	exportDB(os.Args[2], db)
+	// a dry run writes no rejects files either
+	rejects := output
+	if *dryRunFlag {
+		rejects = ""
+	}
 
-}
+	if *mergeFlag {
+		header, r := mergeInputs(rejects, inputs, all, *sourceFlag)
+		writeOutput(output, header, r, settings{output: all[0].output, meta: all[0].meta, namespace: all[0].namespace}, DWCTerms)
+		if err := r.Close(); err != nil {
+			fmt.Println("Cannot save rejected rows:", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 
-// importDB imports a CSV file. It takes a filename as an argument and returns a database
-func importDB(filename string) database {
-	f, err := os.Open(filename)
-	if err != nil {
-		fmt.Printf("Cannot open '%s': %s\n", filename, err.Error())
+	// Stream the input file through the settings into the file
+	// given as second command-line argument
+	if rejects != "" {
+		rejects += ".rejects.csv"
+	}
+	f, header, r := openTable(inputs[0], all[0].dialect, rejects)
+	writeOutput(output, header, r, all[0], DWCTerms)
+	if err := f.Close(); err != nil {
+		fmt.Println("Cannot save rejected rows:", err.Error())
 		os.Exit(1)
 	}
-	defer f.Close()
+}
 
-	// TODO do I need to close the reader?
-	r := csv.NewReader(f)
-	r.LazyQuotes = true
-	rows, err := r.ReadAll()
-	if err != nil {
-		fmt.Println("Cannot read CSV data:", err.Error())
-		os.Exit(1)
+// writeOutput writes the records in r, whose fields match header, to
+// the output file, or to one file for each value of the -partition
+// term. A dry run only shows a preview. dwc is the list of Darwin Core
+// terms.
+func writeOutput(output string, header []string, r recordReader, s settings, dwc []string) {
+	if *dryRunFlag {
+		preview(header, r, s, *previewFlag, dwc)
+		return
+	}
+	if *partitionFlag != "" {
+		exportPartitions(output, *formatFlag, *partitionFlag, *partitionTemplateFlag, header, r, s, dwc)
+		return
+	}
+	exportDB(output, *formatFlag, header, r, s, dwc)
+}
+
+// prepareInput settles how to read and convert one input file. If
+// the input has a .settings file from a previous run (or -profile
+// names a saved profile) those settings are used; otherwise the helper
+// functions ask the user. Options set in given override the saved
+// dialect. dwc is the list of Darwin Core terms and aliases the names
+// others have used for them, for the rename suggestions. It also
+// returns whether the settings have changed and should be saved for
+// next time, see settingsPath.
+func prepareInput(input string, given inputDialect, dwc []string, aliases [][]string) (settings, bool) {
+	// check for .settings file (or the profile), if it exists, apply
+	// the saved settings.  Otherwise, run the helper functions
+	path := settingsPath(input)
+	s, ok := loadSettings(path)
+
+	// how to read the input is kept with it, even with a profile
+	known := ok
+	if *profileFlag != "" {
+		local, found := loadSettings(localSettingsPath(input))
+		s.dialect, known = local.dialect, found
+	} else if ok && s.profile != "" {
+		fmt.Printf("%v only says how to read %v; the rest is in the profile \"%v\". Run with -profile %v to use it,\nor answer the questions below to give %v settings of its own.\n",
+			path, input, s.profile, s.profile, input)
+		s, ok = settings{dialect: s.dialect}, false
+	}
+	s.dialect.joins = resolveJoins(input, s.dialect.joins)
+
+	in := s.dialect
+	in.encoding = given.encoding
+	if given.delimiter != 0 {
+		in.delimiter = given.delimiter
+	}
+	if given.quote != 0 {
+		in.quote = given.quote
+	}
+	if given.sheet != "" {
+		in.sheet = given.sheet
+	}
+	in.ragged = given.ragged
+	in = sniffDialect(input, in)
+
+	// find the header, asking on the first run if it isn't the first row
+	if given.headerRow > 0 {
+		in.headerRow, in.headerRows = given.headerRow, given.headerRows
+	} else if !known {
+		in.headerRow, in.headerRows = headerHelper(input, in)
 	}
+	in.duplicates = checkHeader(input, in, !known)
+
+	// join other tables before the helpers see the columns
+	if len(given.joins) > 0 {
+		in.joins = given.joins
+	}
+	if len(in.joins) > 0 {
+		unjoined := in
+		unjoined.joins = nil
+		f, header, _ := openTable(input, unjoined, "")
+		f.Close()
+		in.joins = loadJoins(header, in.joins, given)
+	}
+	s.dialect = in
+
+	if ok {
+		Prompt(false,`Using settings from previous run. To run with
+clean options and redo the import process, please` +
+	" delete " + localSettingsPath(input) + " "+ " and re-run DWCHelper...")
+
+		// ask only about the columns added since the settings were made
+		f, header, _ := openTable(input, in, "")
+		f.Close()
+		added, gone := diffColumns(s.header, header)
+		changed := s.header == nil || len(added) > 0 || len(gone) > 0
+		// a -delimiter or -quote given on this run is saved too
+		changed = changed || given.delimiter != 0 || given.quote != 0
+		if s.header != nil && len(gone) > 0 {
+			fmt.Println("These columns were in the input when the settings were made, but aren't any more:")
+			printStringSlice(gone)
+			fmt.Println()
+		}
+		if s.header != nil && len(added) > 0 {
+			fmt.Println("These columns are new since the settings were made:")
+			printStringSlice(added)
+			fmt.Println()
+			sum := summarize(input, in)
+			sum.terms = added
+			remove := removeHelper(sum)
+			for _, val := range remove {
+				sum = removeTerm(val, sum)
+			}
+			s.remove = append(s.remove, remove...)
+			s.rename = append(s.rename, renameHelper(sum, dwc, aliases)...)
+		}
+		s.header = header
+		// an export new to the profile has its dialect saved too
+		return s, changed || s.legacy || !known
+	}
+
+	// Summarize the columns of the input file
+	sum := summarize(input, in)
+	s.header = sum.terms
+
+	// remove terms
+	s.remove = removeHelper(sum)
+	for _, val := range s.remove {
+		sum = removeTerm(val, sum)
+	}
+
+	// rename terms
+	s.rename = renameHelper(sum, dwc, aliases)
+	return s, true
+}
+
+// summarize reads a CSV file or workbook once and returns what the
+// helpers need to know about each column, without keeping the rows:
+// whether its values vary, for removeHelper, and a sample of them, for
+// the suggestions of renameHelper
+func summarize(filename string, in inputDialect) summary {
+	f, header, r := openTable(filename, in, "")
+	defer f.Close()
 
-	// Initialize database
-	var db database
-	db.data = make(map[string][]string)
-	// Ordered list of terms
-	db.terms = rows[0]
-	// Fill in columns
-	for i, term := range db.terms {
-		var values []string
-		for _, row := range rows[1:] {
-			values = append(values, row[i])
+	sum := summary{terms: header, varies: make(map[string]bool), samples: make(map[string][]string)}
+	var first []string
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Println("Cannot read CSV data:", err.Error())
+			os.Exit(1)
+		}
+		if first == nil {
+			first = append([]string{}, row...)
+		}
+		for i, term := range header {
+			if row[i] != first[i] {
+				sum.varies[term] = true
+			}
+			if v := strings.TrimSpace(row[i]); v != "" && len(sum.samples[term]) < maxSample {
+				sum.samples[term] = append(sum.samples[term], v)
+			}
 		}
-		db.data[term] = values
 	}
-	return db
+	return sum
 }
 
-// removeTerm removes a given term from the database's list of terms
-func removeTerm(term string, db database) database {
-	if Include(db.terms, term) {
+// removeTerm removes a given term from the summary's list of terms
+func removeTerm(term string, sum summary) summary {
+	if Include(sum.terms, term) {
 		fmt.Println("Removing",term)
-		db.terms = Remove(db.terms, term)
+		sum.terms = Remove(sum.terms, term)
 	}
-	return db
+	return sum
 }
 
 // removeHelper is the interactive helper function that returns a list
 // of terms to be removed
-func removeHelper(db database) []string {
+func removeHelper(sum summary) []string {
 	var termsToRemove []string
 
-	for _, term := range db.terms {
-		if !notAllSame(db.data[term]) {
+	for _, term := range sum.terms {
+		if !sum.varies[term] {
 			termsToRemove = append(termsToRemove, term)
 		}
 	}
@@ -236,20 +513,11 @@ for every specimen:`)
 	return termsToRemove
 }
 
-// renameTerm renames a term in a given database (including the new
-// mapping in the "data" field)
-func renameTerm(oldName, newName string, db database) database {
-	if Include(db.terms, oldName) {
-		fmt.Printf("Renaming \"%v\" to \"%v\"\n",oldName,newName)
-		db.data[newName] = db.data[oldName]
-		db.terms = Rename(db.terms, oldName,newName)
-	}
-	return db
-}
-
 // showTerms displays the list of terms to the user along with some
-// associated information for renameHelper
-func showTerms(terms [][]string, suggestions [][]string) {
+// associated information for renameHelper: the new name, if any, and
+// the best few suggestions with how well each one matches, noting
+// those that come from the values rather than the name
+func showTerms(terms [][]string, suggestions [][]candidate) {
 	var b strings.Builder
 	b.Grow(len(terms) * 2)
 	c := 0
@@ -263,11 +531,17 @@ func showTerms(terms [][]string, suggestions [][]string) {
 		
 			fmt.Fprintf(&b, " ======> %v ",terms[i][1])
 		}
-		if len(suggestions[i]) > 1 {
+		if len(suggestions[i]) > 0 {
 			c = c + 4
 			fmt.Fprintf(&b, "(Suggestions: ")
-			for _, suggestion := range suggestions[i][1:] {
-				fmt.Fprintf(&b, "\"%v\" ",suggestion)
+			for j, suggestion := range suggestions[i] {
+				if j == maxSuggestions {
+					break
+				}
+				fmt.Fprintf(&b, "\"%v\" %.0f%% ", suggestion.term, 100*suggestion.score)
+				if suggestion.byValue {
+					fmt.Fprintf(&b, "from the values ")
+				}
 			}
 			fmt.Fprintf(&b, ")")
 		} else {
@@ -279,42 +553,24 @@ func showTerms(terms [][]string, suggestions [][]string) {
 }
 
 // renameHelper is the interactive helper function that returns a 2D
-// array that maps terms to their new names
-func renameHelper(db database) [][]string {
+// array that maps terms to their new names. aliases are the names
+// others have used for the terms, see pullAliases.
+func renameHelper(sum summary, DWCTerms []string, aliases [][]string) [][]string {
 	var termsAndNewTerms [][]string
-	var suggestions [][]string
-	DWCTerms := pullDWCTerms()
+	var suggestions [][]candidate
 	PrintHLine(1)
 	Prompt(false,`These are the remaining terms. You can select a term by its 
-number and rename it. Some terms have suggestions for names that 
-have been  used by others. It may be helpful to refer to  the list
+number and rename it. Some terms have suggestions for names, with
+how closely each one matches the term (or names used by others, or
+what the values look like). It may be helpful to refer to  the list
 of terms at https://dwc.tdwg.org/terms/ while you do this.`)
 	PrintHLine(1)
 
-	// generate suggestions for each term
-	for i, term := range db.terms {
-
-		// blank suggestions entry 
-		suggestions = append(suggestions, []string{term})
+	// rank the terms and aliases that may suit each column, by its name
+	// and by its values
+	for _, term := range sum.terms {
 		termsAndNewTerms = append(termsAndNewTerms, []string{term})
-		// add DWCTerm if term may be a variation of it
-		for _, DWCTerm := range DWCTerms {
-			if stringIsVariation(term, DWCTerm) {
-				suggestions[i] = append(suggestions[i], DWCTerm)
-			}
-		}
-
-		// add alias from pre-generated aliases.csv file if
-		// term may be a variation of it
-		go func(){
-		for _, row := range pullAliases() {
-			for _, aliasTerm := range row[1:] {
-				if stringIsVariation(term, aliasTerm) {
-					suggestions[i] = append(suggestions[i], row[0])
-				}
-			}
-		}
-		}()
+		suggestions = append(suggestions, mergeCandidates(rankTerms(term, DWCTerms, aliases), contentTerms(sum.samples[term])))
 	}
 
 	showTerms(termsAndNewTerms, suggestions)
@@ -328,10 +584,10 @@ of terms at https://dwc.tdwg.org/terms/ while you do this.`)
 			showTerms(termsAndNewTerms, suggestions)
 		default:
 			if len(termsAndNewTerms[n-1]) > 1 {
-				termsAndNewTerms[n - 1][1] = inputTerm("Please enter the new name for " + termsAndNewTerms[n - 1][0] + ": ", os.Stdin)
+				termsAndNewTerms[n - 1][1] = inputDWCTerm("Please enter the new name for " + termsAndNewTerms[n - 1][0] + ": ", DWCTerms, os.Stdin)
 			} else {
 				termsAndNewTerms[n - 1] = append(termsAndNewTerms[n - 1], 
-					inputTerm("Please enter the new name for \"" + termsAndNewTerms[n - 1][0] + "\": ", os.Stdin))
+					inputDWCTerm("Please enter the new name for \"" + termsAndNewTerms[n - 1][0] + "\": ", DWCTerms, os.Stdin))
 			}
 			if termsAndNewTerms[n-1][1] == "" {
 				termsAndNewTerms[n-1] = []string{termsAndNewTerms[n-1][0]}
@@ -350,7 +606,7 @@ of terms at https://dwc.tdwg.org/terms/ while you do this.`)
 
 // pullAliases pulls the alias database from the repository
 func pullAliases() [][]string {
-	resp, err := http.Get(aliasURL)
+	resp, err := fetchClient.Get(aliasURL)
 	if err != nil {
 	 	fmt.Printf("Cannot pull aliases from upstream: %v\n", err.Error())
 	 	fmt.Println("Skipping the pre-generated alias suggestions...")
@@ -382,7 +638,7 @@ func pullDWCTerms() []string {
 	termList := "type,modified,language,license,rightsHolder,accessRights,bibliographicCitation,references,institutionID,collectionID,datasetID,institutionCode,collectionCode,datasetName,ownerInstitutionCode,basisOfRecord,informationWithheld,dataGeneralizations,dynamicProperties,occurrenceID,catalogNumber,recordNumber,recordedBy,individualCount,organismQuantity,organismQuantityType,sex,lifeStage,reproductiveCondition,behavior,establishmentMeans,occurrenceStatus,preparations,disposition,associatedMedia,associatedReferences,associatedSequences,associatedTaxa,otherCatalogNumbers,occurrenceRemarks,organismID,organismName,organismScope,associatedOccurrences,associatedOrganisms,previousIdentifications,organismRemarks,materialSampleID,eventID,parentEventID,fieldNumber,eventDate,eventTime,startDayOfYear,endDayOfYear,year,month,day,verbatimEventDate,habitat,samplingProtocol,sampleSizeValue,sampleSizeUnit,samplingEffort,fieldNotes,eventRemarks,locationID,higherGeographyID,higherGeography,continent,waterBody,islandGroup,island,country,countryCode,stateProvince,county,municipality,locality,verbatimLocality,minimumElevationInMeters,maximumElevationInMeters,verbatimElevation,minimumDepthInMeters,maximumDepthInMeters,verbatimDepth,minimumDistanceAboveSurfaceInMeters,maximumDistanceAboveSurfaceInMeters,locationAccordingTo,locationRemarks,decimalLatitude,decimalLongitude,geodeticDatum,coordinateUncertaintyInMeters,coordinatePrecision,pointRadiusSpatialFit,verbatimCoordinates,verbatimLatitude,verbatimLongitude,verbatimCoordinateSystem,verbatimSRS,footprintWKT,footprintSRS,footprintSpatialFit,georeferencedBy,georeferencedDate,georeferenceProtocol,georeferenceSources,georeferenceVerificationStatus,georeferenceRemarks,geologicalContextID,earliestEonOrLowestEonothem,latestEonOrHighestEonothem,earliestEraOrLowestErathem,latestEraOrHighestErathem,earliestPeriodOrLowestSystem,latestPeriodOrHighestSystem,earliestEpochOrLowestSeries,latestEpochOrHighestSeries,earliestAgeOrLowestStage,latestAgeOrHighestStage,lowestBiostratigraphicZone,highestBiostratigraphicZone,lithostratigraphicTerms,group,formation,member,bed,identificationID,identificationQualifier,typeStatus,identifiedBy,dateIdentified,identificationReferences,identificationVerificationStatus,identificationRemarks,taxonID,scientificNameID,acceptedNameUsageID,parentNameUsageID,originalNameUsageID,nameAccordingToID,namePublishedInID,taxonConceptID,scientificName,acceptedNameUsage,parentNameUsage,originalNameUsage,nameAccordingTo,namePublishedIn,namePublishedInYear,higherClassification,kingdom,phylum,class,order,family,genus,subgenus,specificEpithet,infraspecificEpithet,taxonRank,verbatimTaxonRank,scientificNameAuthorship,vernacularName,nomenclaturalCode,taxonomicStatus,nomenclaturalStatus,taxonomy's"
 
 	// Try to pull the csv termlist from online
-	resp, err := http.Get(termURL)
+	resp, err := fetchClient.Get(termURL)
 	if err != nil {
 		fmt.Printf("Cannot pull terms from Darwin Core repository: %s\n", err.Error())
 		fmt.Println("Using the built-in terms instead...")
@@ -405,35 +661,10 @@ func pullDWCTerms() []string {
 	return terms
 }
 
-// exportDB exports its database argument to the file at the filename argument
-func exportDB(filename string, db database) {
-	f, err := os.Create(filename)
-	if err != nil {
-		fmt.Printf("Cannot open '%s': %s\n", filename, err.Error())
-		os.Exit(1)
-	}
-	defer f.Close()
-
-	w := csv.NewWriter(f)
-	// fix windows line endings
-	if runtime.GOOS == "windows" {
-		w.UseCRLF = true
-	}
-	w.Write(db.terms)                            // first line contains the terms in order
-	for i := range db.data[db.terms[0]] { // use the length of the first column as the number of rows
-		var row []string
-		for _, value := range db.terms { // for each term
-			row = append(row, db.data[value][i]) // add the value of the term for the current row
-		}
-		if err := w.Write(row); err != nil { // write the row
-			fmt.Println("error writing record to csv:", err)
-		}
-	}
-	w.Flush()
-}
-
-// database holds all of the variables and their data
-type database struct {
-	data  map[string][]string // maps terms to data
-	terms []string          // ordered list of terms
+// summary holds what the helpers need to know about each column of
+// the input, see summarize
+type summary struct {
+	terms   []string            // ordered list of terms
+	varies  map[string]bool     // whether the values aren't all the same
+	samples map[string][]string // up to maxSample non-empty values
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Darwin Core Archive (https://dwc.tdwg.org/text/) is a zip file
+// holding the data file and a meta.xml that describes its columns, as
+// GBIF and the IPT expect.
+const (
+	archiveCoreFile = "occurrence.txt"
+	occurrenceType  = "http://rs.tdwg.org/dwc/terms/Occurrence"
+	dwcNamespace    = "http://rs.tdwg.org/dwc/terms/"
+	dcNamespace     = "http://purl.org/dc/terms/"
+)
+
+// dcTerms are the Simple Darwin Core terms that come from Dublin Core
+var dcTerms = []string{"type", "modified", "language", "license", "rightsHolder", "accessRights", "bibliographicCitation", "references"}
+
+// termIRI returns the IRI of a Darwin Core term, or "" if term isn't
+// in terms. A column already named with an IRI is used as it is.
+func termIRI(term string, terms []string) string {
+	switch {
+	case strings.HasPrefix(term, "http://") || strings.HasPrefix(term, "https://"):
+		return term
+	case Include(dcTerms, term):
+		return dcNamespace + term
+	case Include(terms, term):
+		return dwcNamespace + term
+	}
+	return ""
+}
+
+// archiveMeta is the meta.xml of a Darwin Core Archive
+type archiveMeta struct {
+	XMLName  xml.Name    `xml:"http://rs.tdwg.org/dwc/text/ archive"`
+	Metadata string      `xml:"metadata,attr,omitempty"`
+	Core     archiveCore `xml:"core"`
+}
+
+// archiveCore describes the core data file
+type archiveCore struct {
+	Encoding           string         `xml:"encoding,attr"`
+	FieldsTerminatedBy string         `xml:"fieldsTerminatedBy,attr"`
+	LinesTerminatedBy  string         `xml:"linesTerminatedBy,attr"`
+	FieldsEnclosedBy   string         `xml:"fieldsEnclosedBy,attr"`
+	IgnoreHeaderLines  int            `xml:"ignoreHeaderLines,attr"`
+	RowType            string         `xml:"rowType,attr"`
+	Files              []string       `xml:"files>location"`
+	ID                 *archiveField  `xml:"id"`
+	Fields             []archiveField `xml:"field"`
+}
+
+// archiveField maps a column of the data file to a term
+type archiveField struct {
+	Index int    `xml:"index,attr"`
+	Term  string `xml:"term,attr,omitempty"`
+}
+
+// archiveEscape writes a delimiter the way the Darwin Core text
+// guide expects, with backslash escapes for control characters
+func archiveEscape(s string) string {
+	return strings.NewReplacer("\t", `\t`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+// buildMeta describes a data file with the given header. Columns that
+// aren't Darwin Core terms dwc stay in the data file but aren't
+// declared.
+func buildMeta(header, dwc []string, delimiter rune, crlf bool) archiveMeta {
+	core := archiveCore{
+		Encoding:           "UTF-8",
+		FieldsTerminatedBy: archiveEscape(string(delimiter)),
+		LinesTerminatedBy:  `\n`,
+		FieldsEnclosedBy:   `"`,
+		IgnoreHeaderLines:  1,
+		RowType:            occurrenceType,
+		Files:              []string{archiveCoreFile},
+	}
+	if crlf {
+		core.LinesTerminatedBy = `\r\n`
+	}
+
+	var declared, undeclared []string
+	for i, term := range header {
+		iri := termIRI(term, dwc)
+		switch {
+		case iri == "":
+			undeclared = append(undeclared, term)
+		case Include(declared, iri):
+			fmt.Printf("Column %v repeats the term \"%v\"; only the first is declared in meta.xml\n", i+1, term)
+		default:
+			declared = append(declared, iri)
+			core.Fields = append(core.Fields, archiveField{Index: i, Term: iri})
+			if term == "occurrenceID" {
+				core.ID = &archiveField{Index: i}
+			}
+		}
+	}
+	if len(undeclared) > 0 {
+		fmt.Println("These columns aren't Darwin Core terms, so meta.xml doesn't describe them:")
+		printStringSlice(undeclared)
+		fmt.Println()
+	}
+	return archiveMeta{Core: core}
+}
+
+// writeArchive streams the records in r, keeping the fields named by
+// index, into a Darwin Core Archive at filename. It returns the number
+// of records written. The data file is written in the output dialect
+// out, except for the byte order mark. If cov is not nil, the dataset
+// metadata m goes in the archive as eml.xml, with the coverage cov
+// found in the data. dwc is the list of Darwin Core terms.
+func writeArchive(filename string, header []string, r recordReader, index []int, out outputDialect, m metadata, cov *coverage, dwc []string) int {
+	f := mustCreate(filename)
+	z := zip.NewWriter(f)
+
+	data, err := z.Create(archiveCoreFile)
+	if err != nil {
+		fmt.Printf("Cannot write '%s': %s\n", filename, err.Error())
+		exit(1)
+	}
+	// a byte order mark would end up in the name of the first column
+	out.bom = false
+	w := newCSVWriter(data, out)
+	w.Write(out.header(header))
+	n := convert(r, w, index)
+	finishCSV(filename, w)
+
+	meta := buildMeta(header, dwc, out.comma(), out.crlf)
+	if cov != nil {
+		meta.Metadata = "eml.xml"
+		if err := writeZipXML(z, meta.Metadata, buildEML(m, cov)); err != nil {
+			fmt.Printf("Cannot write '%s': %s\n", filename, err.Error())
+			exit(1)
+		}
+	}
+	if err := writeZipXML(z, "meta.xml", meta); err != nil {
+		fmt.Printf("Cannot write '%s': %s\n", filename, err.Error())
+		exit(1)
+	}
+	if err := z.Close(); err != nil {
+		fmt.Printf("Cannot write '%s': %s\n", filename, err.Error())
+		exit(1)
+	}
+	mustClose(f)
+	return n
+}
+
+// writeZipXML adds an XML document to a zip file
+func writeZipXML(z *zip.Writer, name string, v interface{}) error {
+	w, err := z.Create(name)
+	if err != nil {
+		return err
+	}
+	return writeXML(w, v)
+}
+
+// writeXML writes v as an indented XML document
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildMeta(t *testing.T) {
+	dwc := []string{"occurrenceID", "catalogNumber", "scientificName"}
+	var metaTests = []struct {
+		header []string
+		id     string // the id element, as JSON
+		fields string // the field elements, as JSON
+	}{
+		{[]string{"occurrenceID", "scientificName"},
+			`{"Index":0,"Term":""}`,
+			`[{"Index":0,"Term":"http://rs.tdwg.org/dwc/terms/occurrenceID"},{"Index":1,"Term":"http://rs.tdwg.org/dwc/terms/scientificName"}]`},
+		// columns that aren't terms keep their place in the data file
+		{[]string{"Cutmarks", "catalogNumber", "modified", "occurrenceID"},
+			`{"Index":3,"Term":""}`,
+			`[{"Index":1,"Term":"http://rs.tdwg.org/dwc/terms/catalogNumber"},{"Index":2,"Term":"http://purl.org/dc/terms/modified"},{"Index":3,"Term":"http://rs.tdwg.org/dwc/terms/occurrenceID"}]`},
+		// only the first of a repeated term is declared
+		{[]string{"scientificName", "scientificName", "catalogNumber"},
+			`null`,
+			`[{"Index":0,"Term":"http://rs.tdwg.org/dwc/terms/scientificName"},{"Index":2,"Term":"http://rs.tdwg.org/dwc/terms/catalogNumber"}]`},
+	}
+
+	for _, tt := range metaTests {
+		meta := buildMeta(tt.header, dwc, ',', false)
+		id, _ := json.Marshal(meta.Core.ID)
+		fields, _ := json.Marshal(meta.Core.Fields)
+		if string(id) != tt.id || string(fields) != tt.fields {
+			t.Errorf("buildMeta(%v): expected id %v and fields %v, got %v and %v", tt.header, tt.id, tt.fields, string(id), string(fields))
+		}
+	}
+
+	meta := buildMeta([]string{"occurrenceID"}, dwc, '\t', true)
+	if meta.Core.FieldsTerminatedBy != `\t` || meta.Core.LinesTerminatedBy != `\r\n` {
+		t.Errorf("buildMeta with tabs and CRLF: got %q and %q", meta.Core.FieldsTerminatedBy, meta.Core.LinesTerminatedBy)
+	}
+}
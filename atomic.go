@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// atomicFile is a file that is written under a temporary name and
+// only takes its real name when it is closed, so that a crash or an
+// error halfway through never leaves a half-written file behind (or
+// spoils the one from the last run)
+type atomicFile struct {
+	*os.File
+	name   string // the real name
+	closed bool
+}
+
+// createFile creates a file to be written under a temporary name in
+// the same folder as filename; closing it renames it to filename
+func createFile(filename string) (*atomicFile, error) {
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	// TempFile only lets the owner read the file
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	temporary[f.Name()] = true
+	return &atomicFile{File: f, name: filename}, nil
+}
+
+// Close closes the file and gives it its real name. Closing it again
+// does nothing.
+func (f *atomicFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	defer delete(temporary, f.File.Name())
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	if err := os.Rename(f.File.Name(), f.name); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	return nil
+}
+
+// mustCreate is createFile for output files, giving up if the file
+// can't be created
+func mustCreate(filename string) *atomicFile {
+	f, err := createFile(filename)
+	if err != nil {
+		fmt.Printf("Cannot open '%s': %s\n", filename, err.Error())
+		exit(1)
+	}
+	return f
+}
+
+// mustClose closes an output file, giving up if it can't be saved
+func mustClose(f *atomicFile) {
+	if err := f.Close(); err != nil {
+		fmt.Printf("Cannot write '%s': %s\n", f.name, err.Error())
+		exit(1)
+	}
+}
+
+// temporary is the temporary files and folders that exit removes:
+// those written by createFile that haven't been closed yet, and the
+// spools of exportPartitions
+var temporary = make(map[string]bool)
+
+// exit removes the temporary files and ends the program. The steps
+// that write the output call it instead of os.Exit, which would leave
+// them behind.
+func exit(code int) {
+	for path := range temporary {
+		os.RemoveAll(path)
+	}
+	os.Exit(code)
+}
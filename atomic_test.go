@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "DWCHelper-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "out.csv")
+	if err := ioutil.WriteFile(target, []byte("last run\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var atomicTests = []struct {
+		close bool   // whether the file is closed
+		want  string // the target afterwards
+	}{
+		// a write that never finishes leaves the last run's file alone
+		{false, "last run\n"},
+		{true, "this run\n"},
+	}
+
+	for _, tt := range atomicTests {
+		f, err := createFile(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("this run\n")
+		if tt.close {
+			if err := f.Close(); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+			// closing again does nothing
+			if err := f.Close(); err != nil {
+				t.Errorf("second Close: %v", err)
+			}
+		}
+
+		if contents, _ := ioutil.ReadFile(target); string(contents) != tt.want {
+			t.Errorf("closed %v: expected %q, got %q", tt.close, tt.want, string(contents))
+		}
+		if !tt.close {
+			f.File.Close()
+			os.Remove(f.File.Name())
+		}
+		if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("closed %v: expected only the target in the folder, got %v files", tt.close, len(entries))
+		}
+	}
+
+	if info, err := os.Stat(target); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("expected a file anyone can read, got %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestExitRemovesTemporary(t *testing.T) {
+	// the program giving up halfway through a write, in a process of
+	// its own since exit ends it
+	if dir := os.Getenv("DWCHELPER_EXIT_DIR"); dir != "" {
+		f := mustCreate(filepath.Join(dir, "out.csv"))
+		f.WriteString("half a row")
+		exit(1)
+	}
+
+	dir, err := ioutil.TempDir("", "DWCHelper-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExitRemovesTemporary$")
+	cmd.Env = append(os.Environ(), "DWCHELPER_EXIT_DIR="+dir)
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected the process to exit with an error")
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") || e.Name() == "out.csv" {
+			t.Errorf("expected nothing left behind, found %v", e.Name())
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSample is how many values of a column contentTerms looks at
+const maxSample = 200
+
+// minShare is the share of the sampled values that must fit a pattern
+// before its term is suggested
+const minShare = 0.8
+
+var (
+	isoDate      = regexp.MustCompile(`^(\d{4}-\d{2}(-\d{2})?)([T ][0-9:.]+(Z|[+-]\d{2}:?\d{2})?)?(/\d{4}(-\d{2}(-\d{2})?)?)?$`)
+	yearPattern  = regexp.MustCompile(`^\d{4}$`)
+	codePattern  = regexp.MustCompile(`^[A-Z]{2}$`)
+	binomial     = regexp.MustCompile(`^[A-Z][a-z]+( \([A-Z][a-z]+\))? [a-z]+\.?( [a-z]+\.?)?( [A-Z(].*)?$`)
+	sexValues    = []string{"male", "female", "m", "f", "unknown", "hermaphrodite", "?"}
+	numberFormat = regexp.MustCompile(`^[+-]?\d+(\.\d+)?$`)
+)
+
+// valueKind is a pattern the values of a column can fit, with the term
+// such values usually belong to
+type valueKind struct {
+	term string
+	fits func(value string) bool
+}
+
+// valueKinds are the patterns contentTerms knows, in the order they
+// are tried. Coordinates are handled apart, because they need every
+// value at once to tell latitude from longitude.
+var valueKinds = []valueKind{
+	{"eventDate", func(v string) bool {
+		m := isoDate.FindStringSubmatch(v)
+		if m == nil {
+			return false
+		}
+		layout := "2006-01-02"[:len(m[1])]
+		_, err := time.Parse(layout, m[1])
+		return err == nil
+	}},
+	{"year", func(v string) bool {
+		n, err := strconv.Atoi(v)
+		return yearPattern.MatchString(v) && err == nil && n >= 1500 && n <= time.Now().Year()
+	}},
+	{"countryCode", codePattern.MatchString},
+	{"scientificName", binomial.MatchString},
+	{"sex", func(v string) bool {
+		return Include(sexValues, strings.ToLower(v))
+	}},
+}
+
+// sample returns up to maxSample of the non-empty values, trimmed
+func sample(values []string) []string {
+	var result []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+			if len(result) == maxSample {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// coordinateTerms suggests decimalLatitude or decimalLongitude for
+// values that are decimal degrees. Values within ±90 could be either,
+// so latitude comes first for them.
+func coordinateTerms(values []string) []candidate {
+	fit, decimals := 0, 0
+	largest := 0.0
+	for _, v := range values {
+		if !numberFormat.MatchString(v) {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < -180 || f > 180 {
+			continue
+		}
+		fit++
+		if strings.Contains(v, ".") {
+			decimals++
+		}
+		if f < 0 {
+			f = -f
+		}
+		if f > largest {
+			largest = f
+		}
+	}
+	share := float64(fit) / float64(len(values))
+	// whole numbers are more likely counts than coordinates
+	if share < minShare || decimals*2 < fit {
+		return nil
+	}
+	if largest > 90 {
+		return []candidate{{term: "decimalLongitude", score: 0.9 * share}}
+	}
+	return []candidate{{term: "decimalLatitude", score: 0.9 * share}, {term: "decimalLongitude", score: 0.6 * share}}
+}
+
+// contentTerms suggests terms for a column from its values rather than
+// its name: ISO dates are likely an eventDate, decimal degrees a
+// coordinate, two capital letters a countryCode and so on. The score
+// of each suggestion is the share of the sampled values that fit,
+// scaled so that a value-based suggestion never outranks a column name
+// that is exactly a term.
+func contentTerms(values []string) []candidate {
+	values = sample(values)
+	if len(values) == 0 {
+		return nil
+	}
+	suggestions := coordinateTerms(values)
+	for _, kind := range valueKinds {
+		fit := 0
+		for _, v := range values {
+			if kind.fits(v) {
+				fit++
+			}
+		}
+		if share := float64(fit) / float64(len(values)); share >= minShare {
+			suggestions = append(suggestions, candidate{term: kind.term, score: 0.9 * share})
+		}
+	}
+	for i := range suggestions {
+		suggestions[i].byValue = true
+	}
+	return suggestions
+}
+
+// mergeCandidates combines suggestions for one column, keeping the
+// better score of each term, best first
+func mergeCandidates(lists ...[]candidate) []candidate {
+	var merged []candidate
+	for _, list := range lists {
+		for _, c := range list {
+			found := false
+			for i, m := range merged {
+				if m.term == c.term {
+					found = true
+					if c.score > m.score {
+						merged[i] = c
+					}
+				}
+			}
+			if !found {
+				merged = append(merged, c)
+			}
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].score != merged[j].score {
+			return merged[i].score > merged[j].score
+		}
+		return merged[i].term < merged[j].term
+	})
+	return merged
+}
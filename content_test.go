@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestContentTerms(t *testing.T) {
+	var contentTests = []struct {
+		values []string
+		out    string
+	}{
+		{[]string{"2019-06-01", "2019-06-14", "", "2019-07"}, "[eventDate]"},
+		{[]string{"2019-13-01", "2019-06-31"}, "[]"},
+		{[]string{"1998", "2004", "2019"}, "[year]"},
+		{[]string{"-2.99", "-3.05", "-2.1"}, "[decimalLatitude decimalLongitude]"},
+		{[]string{"35.35", "35.4", "-120.5"}, "[decimalLongitude]"},
+		{[]string{"3", "12", "7"}, "[]"},
+		{[]string{"TZ", "KE", "TZ"}, "[countryCode]"},
+		{[]string{"Homo habilis", "Panthera leo (Linnaeus, 1758)", "Equus sp."}, "[scientificName]"},
+		{[]string{"M", "f", "Female", "?"}, "[sex]"},
+		{[]string{"FLK", "HWK E", "BK"}, "[]"},
+	}
+
+	for _, tt := range contentTests {
+		var terms []string
+		for _, c := range contentTerms(tt.values) {
+			terms = append(terms, c.term)
+		}
+		if result := fmt.Sprint(terms); result != tt.out {
+			t.Errorf("contentTerms(%q): expected %v, got %v", tt.values, tt.out, result)
+		}
+	}
+}
+
+func TestMergeCandidates(t *testing.T) {
+	byName := []candidate{{term: "locality", score: 0.5}, {term: "eventDate", score: 0.45}}
+	byValue := []candidate{{term: "eventDate", score: 0.9, byValue: true}}
+	merged := mergeCandidates(byName, byValue)
+	if result := fmt.Sprint(merged); result != "[{eventDate 0.9 true} {locality 0.5 false}]" {
+		t.Errorf("mergeCandidates: got %v", result)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// inputDialect describes how to read an input file. Zero values mean
+// "detect it from the file".
+type inputDialect struct {
+	encoding  string // character encoding, or "auto" to detect it
+	delimiter rune   // field separator
+	quote     rune   // quote character, either " or '
+	sheet     string // sheet to read from a workbook
+	ragged    string // what to do with rows of the wrong length, see fitRows
+
+	// where the header is: the row holding the column names, and how
+	// many rows (ending with that one) to join into the names
+	headerRow, headerRows int
+
+	// what to do with each repeated or blank column name, see fixHeader
+	duplicates map[string]string
+
+	// other tables to join to this one, see joinTable
+	joins []join
+}
+
+// delimiters maps the names accepted on the command line and in the
+// settings file to field separators, in order of preference when
+// sniffing a file
+var delimiters = []struct {
+	name string
+	r    rune
+}{
+	{"comma", ','},
+	{"semicolon", ';'},
+	{"tab", '\t'},
+	{"pipe", '|'},
+}
+
+// parseDelimiter turns a delimiter name like "tab", or a single
+// character, into a rune
+func parseDelimiter(s string) (rune, error) {
+	for _, d := range delimiters {
+		if strings.EqualFold(s, d.name) {
+			return d.r, nil
+		}
+	}
+	if s == `\t` {
+		return '\t', nil
+	}
+	r := []rune(s)
+	if len(r) != 1 || r[0] == '"' || r[0] == '\'' || r[0] == '\r' || r[0] == '\n' {
+		return 0, fmt.Errorf("'%s' is not a valid delimiter", s)
+	}
+	return r[0], nil
+}
+
+// delimiterName returns the name of a field separator for reports and
+// the settings file
+func delimiterName(r rune) string {
+	for _, d := range delimiters {
+		if d.r == r {
+			return d.name
+		}
+	}
+	return string(r)
+}
+
+// parseQuote checks that s is a quote character DWCHelper can read
+func parseQuote(s string) (rune, error) {
+	switch s {
+	case `"`, "double":
+		return '"', nil
+	case "'", "single":
+		return '\'', nil
+	}
+	return 0, fmt.Errorf("'%s' is not a valid quote character (use \" or ')", s)
+}
+
+// sniffDialect returns the dialect for the named file, with anything
+// not already set in in detected from the first lines of the file
+func sniffDialect(filename string, in inputDialect) inputDialect {
+	f, err := os.Open(filename)
+	if err != nil {
+		fmt.Printf("Cannot open '%s': %s\n", filename, err.Error())
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	if isWorkbook(filename) {
+		in.sheet = chooseSheet(filename, in.sheet)
+		return in
+	}
+
+	if in.encoding == "" || in.encoding == "auto" {
+		sample := make([]byte, sampleSize)
+		n, _ := io.ReadFull(f, sample)
+		in.encoding, _ = detectEncoding(sample[:n])
+		if in.encoding != "utf-8" {
+			fmt.Printf("Detected %v input (use -encoding to override)\n", in.encoding)
+		}
+		f.Seek(0, io.SeekStart)
+	}
+
+	if in.delimiter != 0 && in.quote != 0 {
+		return in
+	}
+
+	br := bufio.NewReaderSize(decodeInput(f, in.encoding), sampleSize)
+	sample, err := br.Peek(sampleSize)
+	lines := strings.Split(string(sample), "\n")
+	if err == nil {
+		// the last line was cut off
+		lines = lines[:len(lines)-1]
+	}
+	var sampleLines []string
+	for _, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) != "" {
+			sampleLines = append(sampleLines, line)
+		}
+		if len(sampleLines) == 20 {
+			break
+		}
+	}
+
+	delimiter, quote := sniff(sampleLines)
+	if in.quote == 0 {
+		in.quote = quote
+	}
+	if in.delimiter == 0 {
+		in.delimiter = delimiter
+	}
+	fmt.Printf("Reading %v as %v-separated values quoted with %c (use -delimiter and -quote to override)\n",
+		filename, delimiterName(in.delimiter), in.quote)
+	return in
+}
+
+// chooseSheet checks that the named sheet is in the workbook, or asks
+// the user to pick one if no sheet was named and there's a choice
+func chooseSheet(filename, sheet string) string {
+	names, err := sheetNames(filename)
+	if err != nil {
+		fmt.Printf("Cannot read '%s': %s\n", filename, err.Error())
+		os.Exit(1)
+	}
+	if len(names) == 0 {
+		fmt.Printf("'%s' has no sheets\n", filename)
+		os.Exit(1)
+	}
+	if sheet != "" {
+		if !Include(names, sheet) {
+			fmt.Printf("'%s' has no sheet called '%s'\n", filename, sheet)
+			os.Exit(1)
+		}
+		return sheet
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v has more than one sheet. Which one holds your data?\n", filename)
+	for i, name := range names {
+		fmt.Fprintf(&b, "%v: %v\n", i+1, name)
+	}
+	PrintHLine(1)
+	Prompt(false, b.String())
+	PrintHLine(1)
+	n := inputNumber(1, len(names), os.Stdin)
+	if n == 0 {
+		// no answer
+		n = 1
+	}
+	return names[n-1]
+}
+
+// sniff infers the delimiter and quote character from a sample of
+// lines. The delimiter is the candidate that appears the same number
+// of times (outside quotes) on the most lines.
+func sniff(lines []string) (rune, rune) {
+	quote := '"'
+	if quoteScore(lines, '\'') > 0 && quoteScore(lines, '"') == 0 {
+		quote = '\''
+	}
+
+	delimiter := ','
+	bestConsistency, bestCount := 0, 0
+	for _, d := range delimiters {
+		counts := make(map[int]int)
+		for _, line := range lines {
+			counts[countOutsideQuotes(line, d.r, quote)]++
+		}
+		// the most common number of delimiters per line
+		mode, consistency := 0, 0
+		for count, lines := range counts {
+			if lines > consistency || (lines == consistency && count > mode) {
+				mode, consistency = count, lines
+			}
+		}
+		if mode == 0 {
+			continue
+		}
+		if consistency > bestConsistency || (consistency == bestConsistency && mode > bestCount) {
+			delimiter, bestConsistency, bestCount = d.r, consistency, mode
+		}
+	}
+	return delimiter, quote
+}
+
+// quoteScore counts how often q appears at the edge of a field, which
+// is where a quote character would be
+func quoteScore(lines []string, q rune) int {
+	score := 0
+	for _, line := range lines {
+		r := []rune(line)
+		for i, c := range r {
+			if c != q {
+				continue
+			}
+			if i == 0 || i == len(r)-1 || isDelimiter(r[i-1]) || isDelimiter(r[i+1]) {
+				score++
+			}
+		}
+	}
+	return score
+}
+
+// isDelimiter returns true if r is one of the candidate delimiters
+func isDelimiter(r rune) bool {
+	for _, d := range delimiters {
+		if d.r == r {
+			return true
+		}
+	}
+	return false
+}
+
+// countOutsideQuotes counts the occurrences of d in line that aren't
+// inside a quoted field
+func countOutsideQuotes(line string, d, quote rune) int {
+	n := 0
+	quoted := false
+	for _, c := range line {
+		switch c {
+		case quote:
+			quoted = !quoted
+		case d:
+			if !quoted {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// swapQuotes exchanges single and double quotes in the bytes it
+// reads, so that encoding/csv (which only understands double quotes)
+// can parse a file quoted with single quotes
+type swapQuotes struct {
+	r io.Reader
+}
+
+func (s swapQuotes) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	for i := range p[:n] {
+		switch p[i] {
+		case '"':
+			p[i] = '\''
+		case '\'':
+			p[i] = '"'
+		}
+	}
+	return n, err
+}
+
+// unswapQuotes puts the quotes exchanged by swapQuotes back into
+// each field
+type unswapQuotes struct {
+	*csv.Reader
+}
+
+func (u unswapQuotes) Read() ([]string, error) {
+	record, err := u.Reader.Read()
+	for i, field := range record {
+		if strings.ContainsAny(field, `"'`) {
+			record[i] = strings.Map(func(c rune) rune {
+				switch c {
+				case '"':
+					return '\''
+				case '\'':
+					return '"'
+				}
+				return c
+			}, field)
+		}
+	}
+	return record, err
+}
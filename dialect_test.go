@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSniff(t *testing.T) {
+	var sniffTests = []struct {
+		lines     []string // sample of the file
+		delimiter rune     // detected delimiter
+		quote     rune     // detected quote character
+	}{
+		{[]string{"a,b,c", "1,2,3"}, ',', '"'},
+		{[]string{"a;b;c", "1,5;2,5;3"}, ';', '"'},
+		{[]string{"a\tb\tc", "1\t2\t3"}, '\t', '"'},
+		{[]string{"a|b", "x, y|z"}, '|', '"'},
+		{[]string{`"a;b",c`, `"1;2",3`}, ',', '"'},
+		{[]string{"'a,b';c", "'it''s';d"}, ';', '\''},
+		{[]string{"O'Brien,Leakey", "1,2"}, ',', '"'},
+		{[]string{"single column", "value"}, ',', '"'},
+		{[]string{}, ',', '"'},
+	}
+
+	for _, tt := range sniffTests {
+		delimiter, quote := sniff(tt.lines)
+		if delimiter != tt.delimiter || quote != tt.quote {
+			t.Errorf("sniff(%q): expected %q %q, got %q %q", tt.lines, tt.delimiter, tt.quote, delimiter, quote)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metadata describes the dataset as a whole, for the eml.xml that
+// publishing a dataset needs. It is saved in the settings file.
+type metadata struct {
+	title     string
+	abstract  string
+	creators  []creator
+	license   string // key of licenses
+	geography string // description of the geographic coverage
+}
+
+// complete returns true if m has what a published dataset needs
+func (m metadata) complete() bool {
+	return m.title != "" && len(m.creators) > 0 && m.license != ""
+}
+
+// creator is a person (or organisation) responsible for the dataset
+type creator struct {
+	name, organisation, email string
+}
+
+// licenses are the licenses GBIF accepts for published data
+var licenses = []struct {
+	key, title, url string
+}{
+	{"CC0-1.0", "Public Domain (CC0 1.0)", "http://creativecommons.org/publicdomain/zero/1.0/legalcode"},
+	{"CC-BY-4.0", "Creative Commons Attribution (CC-BY) 4.0", "http://creativecommons.org/licenses/by/4.0/legalcode"},
+	{"CC-BY-NC-4.0", "Creative Commons Attribution Non Commercial (CC-BY-NC) 4.0", "http://creativecommons.org/licenses/by-nc/4.0/legalcode"},
+}
+
+// coverage collects the geographic and temporal extent of the data
+// as it is exported
+type coverage struct {
+	r                        recordReader
+	lat, lon, date           int // input fields, or -1
+	north, south, east, west float64
+	coordinates              bool // whether any coordinates were found
+	begin, end               string
+}
+
+// watch wraps r so that the coverage of the records read through it
+// is collected. terms and index are the output header and the input
+// field of each output column, as returned by plan.
+func (c *coverage) watch(r recordReader, terms []string, index []int) recordReader {
+	field := func(term string) int {
+		if i := Index(terms, term); i >= 0 {
+			return index[i]
+		}
+		return -1
+	}
+	c.r = r
+	c.lat, c.lon, c.date = field("decimalLatitude"), field("decimalLongitude"), field("eventDate")
+	c.north, c.south, c.east, c.west = -90, 90, -180, 180
+	return c
+}
+
+func (c *coverage) Read() ([]string, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		return record, err
+	}
+	if c.lat >= 0 && c.lon >= 0 {
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(record[c.lat]), 64)
+		lon, err2 := strconv.ParseFloat(strings.TrimSpace(record[c.lon]), 64)
+		if err1 == nil && err2 == nil && math.Abs(lat) <= 90 && math.Abs(lon) <= 180 {
+			c.coordinates = true
+			c.north, c.south = math.Max(c.north, lat), math.Min(c.south, lat)
+			c.east, c.west = math.Max(c.east, lon), math.Min(c.west, lon)
+		}
+	}
+	if c.date >= 0 {
+		if begin, end, ok := dateRange(record[c.date]); ok {
+			if c.begin == "" || begin < c.begin {
+				c.begin = begin
+			}
+			if end > c.end {
+				c.end = end
+			}
+		}
+	}
+	return record, nil
+}
+
+// dateRange reads an ISO 8601 eventDate such as "2019-06-01",
+// "2019-06", "2019" or "2019-06-01/2019-06-10" and returns the first
+// and last days it covers
+func dateRange(s string) (string, string, bool) {
+	parts := strings.SplitN(strings.TrimSpace(s), "/", 2)
+	first, _, ok := dayRange(parts[0])
+	if !ok {
+		return "", "", false
+	}
+	_, last, ok := dayRange(parts[len(parts)-1])
+	if !ok || last < first {
+		return "", "", false
+	}
+	return first, last, true
+}
+
+// dayRange returns the first and last day of a date that may leave out
+// the day or month
+func dayRange(s string) (string, string, bool) {
+	// leave out any time of day
+	if i := strings.IndexByte(s, 'T'); i >= 0 {
+		s = s[:i]
+	}
+	const day = "2006-01-02"
+	if t, err := time.Parse(day, s); err == nil {
+		return t.Format(day), t.Format(day), true
+	}
+	if t, err := time.Parse("2006-01", s); err == nil {
+		return t.Format(day), t.AddDate(0, 1, -1).Format(day), true
+	}
+	if t, err := time.Parse("2006", s); err == nil {
+		return t.Format(day), t.AddDate(1, 0, -1).Format(day), true
+	}
+	return "", "", false
+}
+
+// emlDoc is an EML document following the GBIF metadata profile
+type emlDoc struct {
+	XMLName   struct{}   `xml:"eml:eml"`
+	XmlnsEML  string     `xml:"xmlns:eml,attr"`
+	XmlnsXSI  string     `xml:"xmlns:xsi,attr"`
+	Schema    string     `xml:"xsi:schemaLocation,attr"`
+	PackageID string     `xml:"packageId,attr"`
+	System    string     `xml:"system,attr"`
+	Scope     string     `xml:"scope,attr"`
+	Lang      string     `xml:"xml:lang,attr"`
+	Dataset   emlDataset `xml:"dataset"`
+}
+
+type emlDataset struct {
+	Title            string       `xml:"title"`
+	Creators         []emlParty   `xml:"creator"`
+	MetadataProvider []emlParty   `xml:"metadataProvider"`
+	PubDate          string       `xml:"pubDate"`
+	Language         string       `xml:"language"`
+	Abstract         *emlPara     `xml:"abstract"`
+	Rights           *emlRights   `xml:"intellectualRights"`
+	Coverage         *emlCoverage `xml:"coverage"`
+	Contact          []emlParty   `xml:"contact"`
+}
+
+type emlParty struct {
+	Individual   *emlName `xml:"individualName"`
+	Organisation string   `xml:"organizationName,omitempty"`
+	Email        string   `xml:"electronicMailAddress,omitempty"`
+}
+
+type emlName struct {
+	Given string `xml:"givenName,omitempty"`
+	Sur   string `xml:"surName"`
+}
+
+type emlPara struct {
+	Para string `xml:"para"`
+}
+
+type emlRights struct {
+	Para struct {
+		Text  string `xml:",chardata"`
+		ULink struct {
+			URL   string `xml:"url,attr"`
+			Title string `xml:"citetitle"`
+		} `xml:"ulink"`
+	} `xml:"para"`
+}
+
+type emlCoverage struct {
+	Geographic *emlGeographic `xml:"geographicCoverage"`
+	Temporal   *emlTemporal   `xml:"temporalCoverage"`
+}
+
+type emlGeographic struct {
+	Description string `xml:"geographicDescription"`
+	West        string `xml:"boundingCoordinates>westBoundingCoordinate"`
+	East        string `xml:"boundingCoordinates>eastBoundingCoordinate"`
+	North       string `xml:"boundingCoordinates>northBoundingCoordinate"`
+	South       string `xml:"boundingCoordinates>southBoundingCoordinate"`
+}
+
+type emlTemporal struct {
+	Begin string `xml:"rangeOfDates>beginDate>calendarDate"`
+	End   string `xml:"rangeOfDates>endDate>calendarDate"`
+}
+
+// party turns a creator into an EML responsible party
+func (c creator) party() emlParty {
+	p := emlParty{Organisation: c.organisation, Email: c.email}
+	if c.name != "" {
+		// the last word is the surname
+		words := strings.Fields(c.name)
+		p.Individual = &emlName{Sur: words[len(words)-1], Given: strings.Join(words[:len(words)-1], " ")}
+	}
+	return p
+}
+
+// buildEML describes the dataset in EML, with the coverage found in
+// the data
+func buildEML(m metadata, c *coverage) emlDoc {
+	doc := emlDoc{
+		XmlnsEML:  "eml://ecoinformatics.org/eml-2.1.1",
+		XmlnsXSI:  "http://www.w3.org/2001/XMLSchema-instance",
+		Schema:    "eml://ecoinformatics.org/eml-2.1.1 http://rs.gbif.org/schema/eml-gbif-profile/1.1/eml.xsd",
+		PackageID: newUUID(),
+		System:    "http://gbif.org",
+		Scope:     "system",
+		Lang:      "en",
+	}
+	d := &doc.Dataset
+	d.Title = m.title
+	for _, c := range m.creators {
+		d.Creators = append(d.Creators, c.party())
+	}
+	d.MetadataProvider = d.Creators
+	d.Contact = d.Creators
+	d.PubDate = time.Now().Format("2006-01-02")
+	d.Language = "en"
+	if m.abstract != "" {
+		d.Abstract = &emlPara{m.abstract}
+	}
+
+	for _, l := range licenses {
+		if l.key == m.license {
+			d.Rights = &emlRights{}
+			d.Rights.Para.Text = "This work is licensed under a "
+			d.Rights.Para.ULink.URL = l.url
+			d.Rights.Para.ULink.Title = l.title
+		}
+	}
+
+	if c.coordinates || c.begin != "" {
+		d.Coverage = &emlCoverage{}
+	}
+	if c.coordinates {
+		// the profile needs a description; without one, the bounding
+		// box describes itself
+		description := m.geography
+		if description == "" {
+			description = fmt.Sprintf("Latitudes %v to %v, longitudes %v to %v",
+				formatNumber(c.south), formatNumber(c.north), formatNumber(c.west), formatNumber(c.east))
+		}
+		d.Coverage.Geographic = &emlGeographic{
+			Description: description,
+			West:        formatNumber(c.west),
+			East:        formatNumber(c.east),
+			North:       formatNumber(c.north),
+			South:       formatNumber(c.south),
+		}
+	}
+	if c.begin != "" {
+		d.Coverage.Temporal = &emlTemporal{c.begin, c.end}
+	}
+	return doc
+}
+
+// newUUID returns a random (version 4) UUID to identify the metadata
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// writeEML writes the dataset metadata to the file at filename
+func writeEML(filename string, m metadata, c *coverage) {
+	f := mustCreate(filename)
+	if err := writeXML(f, buildEML(m, c)); err != nil {
+		fmt.Printf("Cannot write '%s': %s\n", filename, err.Error())
+		exit(1)
+	}
+	mustClose(f)
+	fmt.Println("Wrote dataset metadata to", filename)
+}
+
+// inputRequired asks for an answer until the user gives one. It
+// returns an error if the input ends first, instead of asking forever.
+func inputRequired(message string, r io.Reader) (string, error) {
+	for {
+		fmt.Print(message)
+		b := bufio.NewScanner(r)
+		ok := b.Scan()
+		fmt.Println()
+		if !ok {
+			return "", fmt.Errorf("no answer to \"%s\" before the input ended", strings.TrimSpace(message))
+		}
+		if text := strings.TrimSpace(b.Text()); text != "" {
+			return text, nil
+		}
+	}
+}
+
+// metadataHelper is the interactive helper function that asks for
+// whatever dataset metadata is still missing, reading the answers from
+// r. It returns an error if r ends before the metadata is complete.
+func metadataHelper(m metadata, r io.Reader) (metadata, error) {
+	PrintHLine(1)
+	Prompt(false, `Publishing your data needs some information about the dataset as a
+whole. The area and dates it covers are worked out from the
+decimalLatitude, decimalLongitude and eventDate columns.`)
+	PrintHLine(1)
+
+	var err error
+	if m.title == "" {
+		if m.title, err = inputRequired("Title of the dataset: ", r); err != nil {
+			return m, err
+		}
+	}
+	if m.abstract == "" {
+		m.abstract = strings.TrimSpace(inputTerm("Short description (abstract) of the dataset: ", r))
+	}
+	if len(m.creators) == 0 {
+		fmt.Println("Who created the dataset? Enter each person in turn, and an empty name when you are done.")
+		for {
+			var c creator
+			if len(m.creators) == 0 {
+				// a dataset needs at least one
+				if c.name, err = inputRequired("Name: ", r); err != nil {
+					return m, err
+				}
+			} else {
+				c.name = strings.TrimSpace(inputTerm("Name: ", r))
+			}
+			if c.name == "" {
+				break
+			}
+			c.organisation = strings.TrimSpace(inputTerm("Institution or organisation: ", r))
+			c.email = strings.TrimSpace(inputTerm("Email address: ", r))
+			m.creators = append(m.creators, c)
+		}
+	}
+	if m.license == "" {
+		var b strings.Builder
+		fmt.Fprintln(&b, "Which license should the data be published under?")
+		for i, l := range licenses {
+			fmt.Fprintf(&b, "%v: %v\n", i+1, l.title)
+		}
+		Prompt(false, b.String())
+		// inputNumber only gives 0 when the input ends
+		n := inputNumber(1, len(licenses), r)
+		if n == 0 {
+			return m, fmt.Errorf("no license chosen before the input ended")
+		}
+		m.license = licenses[n-1].key
+	}
+	if m.geography == "" {
+		m.geography = strings.TrimSpace(inputTerm("Description of the area covered (such as \"Olduvai Gorge, Tanzania\"): ", r))
+	}
+	return m, nil
+}
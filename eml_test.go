@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestDateRange(t *testing.T) {
+	var dateTests = []struct {
+		eventDate  string
+		begin, end string
+		ok         bool
+	}{
+		{"2019-06-01", "2019-06-01", "2019-06-01", true},
+		{"2019-06-01T14:30:00", "2019-06-01", "2019-06-01", true},
+		{"2019-06", "2019-06-01", "2019-06-30", true},
+		{"2020-02", "2020-02-01", "2020-02-29", true},
+		{"2019", "2019-01-01", "2019-12-31", true},
+		{"2019-06-01/2019-06-10", "2019-06-01", "2019-06-10", true},
+		{"2019-06/2019-08", "2019-06-01", "2019-08-31", true},
+		{"2019-06-10/2019-06-01", "", "", false},
+		{"June 2019", "", "", false},
+		{"", "", "", false},
+	}
+
+	for _, tt := range dateTests {
+		begin, end, ok := dateRange(tt.eventDate)
+		if begin != tt.begin || end != tt.end || ok != tt.ok {
+			t.Errorf("dateRange(%q): expected %v %v %v, got %v %v %v", tt.eventDate, tt.begin, tt.end, tt.ok, begin, end, ok)
+		}
+	}
+}
+
+func TestBuildEML(t *testing.T) {
+	creators := []creator{{name: "Mary Leakey"}}
+	bounded := &coverage{coordinates: true, north: -2.9, south: -3.1, east: 35.4, west: 35.2}
+	var emlTests = []struct {
+		m       metadata
+		c       *coverage
+		want    []string // in the dataset element
+		notWant []string
+	}{
+		{metadata{title: "Olduvai", creators: creators, abstract: "Fossils", geography: "Olduvai Gorge, Tanzania"}, bounded,
+			[]string{"<abstract><para>Fossils</para></abstract>", "<geographicDescription>Olduvai Gorge, Tanzania</geographicDescription>"}, nil},
+		// skipped prompts leave out the abstract, and the bounding box
+		// describes the area
+		{metadata{title: "Olduvai", creators: creators}, bounded,
+			[]string{"<geographicDescription>Latitudes -3.1 to -2.9, longitudes 35.2 to 35.4</geographicDescription>"},
+			[]string{"<abstract>"}},
+		{metadata{title: "Olduvai", creators: creators}, &coverage{},
+			nil, []string{"<abstract>", "<coverage>", "<geographicDescription>"}},
+	}
+
+	for _, tt := range emlTests {
+		result, err := xml.Marshal(buildEML(tt.m, tt.c).Dataset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(string(result), s) {
+				t.Errorf("buildEML(%+v): expected %v in %v", tt.m, s, string(result))
+			}
+		}
+		for _, s := range tt.notWant {
+			if strings.Contains(string(result), s) {
+				t.Errorf("buildEML(%+v): unexpected %v in %v", tt.m, s, string(result))
+			}
+		}
+	}
+}
+
+func TestMetadataHelper(t *testing.T) {
+	complete := metadata{title: "Olduvai", creators: []creator{{name: "Mary Leakey"}}, license: "CC0-1.0"}
+	var helperTests = []struct {
+		m     metadata
+		input string
+		ok    bool
+	}{
+		// the input ending stops the questions instead of repeating them
+		{metadata{}, "", false},
+		{metadata{title: "Olduvai"}, "", false},
+		{metadata{title: "Olduvai", creators: complete.creators}, "", false},
+		{metadata{}, "Olduvai\n", false},
+		// nothing is asked for once the metadata is complete
+		{complete, "", true},
+	}
+
+	for _, tt := range helperTests {
+		m, err := metadataHelper(tt.m, strings.NewReader(tt.input))
+		if (err == nil) != tt.ok || (tt.ok && !m.complete()) {
+			t.Errorf("metadataHelper(%+v) with input %q: expected ok %v, got %+v (%v)", tt.m, tt.input, tt.ok, m, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// sampleSize is how many bytes of the input are examined when
+// guessing its character encoding
+const sampleSize = 64 * 1024
+
+// byte order marks for the Unicode encodings we recognise
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// detectEncoding guesses the character encoding of sample, which is
+// the start of a file. It returns the name of the encoding (as
+// understood by htmlindex) and the length of the byte order mark, if
+// there is one. Microsoft Access and Excel usually export UTF-8 with a
+// BOM, UTF-16LE with a BOM, or Windows-1252.
+func detectEncoding(sample []byte) (string, int) {
+	switch {
+	case bytes.HasPrefix(sample, bomUTF8):
+		return "utf-8", len(bomUTF8)
+	case bytes.HasPrefix(sample, bomUTF16LE):
+		return "utf-16le", len(bomUTF16LE)
+	case bytes.HasPrefix(sample, bomUTF16BE):
+		return "utf-16be", len(bomUTF16BE)
+	}
+
+	// UTF-16 without a BOM: mostly-ASCII text has a zero in every
+	// other byte
+	var even, odd int
+	for i, b := range sample {
+		if b == 0 {
+			if i%2 == 0 {
+				even++
+			} else {
+				odd++
+			}
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case pairs > 0 && odd*5 > pairs*2 && even*10 < pairs:
+		return "utf-16le", 0
+	case pairs > 0 && even*5 > pairs*2 && odd*10 < pairs:
+		return "utf-16be", 0
+	}
+
+	// the sample may end part way through a multi-byte character
+	if len(sample) == sampleSize {
+		for i := len(sample) - 1; i >= 0 && i >= len(sample)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(sample[i]) {
+				if !utf8.FullRune(sample[i:]) {
+					sample = sample[:i]
+				}
+				break
+			}
+		}
+	}
+	if utf8.Valid(sample) {
+		return "utf-8", 0
+	}
+
+	// anything else is most likely a Windows code page
+	return "windows-1252", 0
+}
+
+// decodeInput wraps f so that it yields UTF-8. If name is empty or
+// "auto" the encoding is detected from the start of the file;
+// otherwise name is looked up in the WHATWG encoding index, so labels
+// like "utf-16le", "latin1" or "windows-1252" all work. Any byte order
+// mark is dropped.
+func decodeInput(f io.Reader, name string) io.Reader {
+	br := bufio.NewReaderSize(f, sampleSize)
+	sample, err := br.Peek(sampleSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		fmt.Println("Cannot read input:", err.Error())
+		os.Exit(1)
+	}
+
+	detected, bom := detectEncoding(sample)
+	if name == "" || name == "auto" {
+		name = detected
+		if name != "utf-8" || bom > 0 {
+			fmt.Printf("Detected %v input", name)
+			if bom > 0 {
+				fmt.Print(" with a byte order mark")
+			}
+			fmt.Println(" (use -encoding to override)")
+		}
+	} else if !strings.HasPrefix(detected, "utf-") {
+		// only a Unicode BOM can be skipped regardless of the
+		// encoding the user asked for
+		bom = 0
+	}
+	br.Discard(bom)
+
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		fmt.Printf("Unknown character encoding '%s': %s\n", name, err.Error())
+		os.Exit(1)
+	}
+	if canonical, _ := htmlindex.Name(enc); canonical == "utf-8" {
+		return br
+	}
+	return transform.NewReader(br, enc.NewDecoder())
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	var detectTests = []struct {
+		sample []byte // start of the file
+		name   string // detected encoding
+		bom    int    // length of the byte order mark
+	}{
+		{[]byte("a,b\n1,2\n"), "utf-8", 0},
+		{[]byte("\xEF\xBB\xBFa,b\n"), "utf-8", 3},
+		{[]byte("\xFF\xFEa\x00,\x00b\x00"), "utf-16le", 2},
+		{[]byte("\xFE\xFF\x00a\x00,\x00b"), "utf-16be", 2},
+		{[]byte("a\x00,\x00b\x00\n\x00"), "utf-16le", 0},
+		{[]byte("\x00a\x00,\x00b\x00\n"), "utf-16be", 0},
+		{[]byte("Locality\nOlduva\xef Gorge\n"), "windows-1252", 0},
+		{[]byte("Locality\nOlduvaï Gorge\n"), "utf-8", 0},
+		{[]byte{}, "utf-8", 0},
+	}
+
+	for _, tt := range detectTests {
+		name, bom := detectEncoding(tt.sample)
+		if name != tt.name || bom != tt.bom {
+			t.Errorf("detectEncoding(%q): expected %v, %v, got %v, %v", tt.sample, tt.name, tt.bom, name, bom)
+		}
+	}
+}
+
+// utf16LE encodes s as UTF-16LE with a byte order mark, the way
+// Access exports "Unicode" text
+func utf16LE(s string) []byte {
+	b := []byte{0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+func TestDecodeInput(t *testing.T) {
+	const text = "Locality,Country\r\nOlduvaï Gorge,Tanzania\r\n"
+	bom := "\xEF\xBB\xBF" + text
+	cp1252 := "Locality,Country\r\nOlduva\xEF Gorge,Tanzania\r\n"
+	var decodeTests = []struct {
+		in       string // input file
+		encoding string // -encoding
+		out      string // decoded input
+	}{
+		{text, "", text},
+		{bom, "", text},
+		{string(utf16LE(text)), "", text},
+		{cp1252, "", text},
+		{cp1252, "auto", text},
+		// -encoding wins over the guess, and still drops a Unicode BOM
+		{cp1252, "utf-8", "Locality,Country\r\nOlduva\xEF Gorge,Tanzania\r\n"},
+		{cp1252, "latin1", text},
+		{bom, "utf-8", text},
+		{bom, "windows-1252", "Locality,Country\r\nOlduvaÃ¯ Gorge,Tanzania\r\n"},
+		{string(utf16LE(text)), "utf-16le", text},
+	}
+
+	for _, tt := range decodeTests {
+		out, err := ioutil.ReadAll(decodeInput(bytes.NewReader([]byte(tt.in)), tt.encoding))
+		if err != nil || string(out) != tt.out {
+			t.Errorf("decodeInput(%q, %q): expected %q, got %q (%v)", tt.in, tt.encoding, tt.out, out, err)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// What to do with a column name that appears more than once, or is
+// blank, in the header. Left alone, the columns would overwrite each
+// other in database.data and one column's data would be lost.
+const (
+	dupSuffix = "suffix" // keep every column, numbering the repeats
+	dupMerge  = "merge"  // combine them into one column
+	dupDrop   = "drop"   // keep the first column only
+)
+
+// mergeSeparator joins the values of merged columns, as Darwin Core
+// recommends for lists
+const mergeSeparator = " | "
+
+// duplicateHeaders returns the names that appear more than once in
+// header, in order, with the positions of each. Blank names are
+// always included, since they can't tell columns apart either.
+func duplicateHeaders(header []string) ([]string, map[string][]int) {
+	positions := make(map[string][]int)
+	var names []string
+	for i, name := range header {
+		name = headerKey(name)
+		if _, ok := positions[name]; !ok {
+			names = append(names, name)
+		}
+		positions[name] = append(positions[name], i)
+	}
+
+	var dups []string
+	for _, name := range names {
+		if len(positions[name]) > 1 || name == "" {
+			dups = append(dups, name)
+		}
+	}
+	return dups, positions
+}
+
+// headerKey returns the name a column is known by when looking for
+// repeats: the name itself, or "" if it is blank
+func headerKey(name string) string {
+	if strings.TrimSpace(name) == "" {
+		return ""
+	}
+	return name
+}
+
+// headerFix describes the columns that come out of a header once
+// repeated and blank names are dealt with: each output column has a
+// name and the input fields it is made from
+type headerFix struct {
+	names   []string
+	sources [][]int
+}
+
+// fixHeader works out the output columns for header, given a choice
+// (suffix, merge or drop) for each repeated or blank name. Names
+// without a choice are numbered.
+func fixHeader(header []string, choices map[string]string) headerFix {
+	dups, positions := duplicateHeaders(header)
+	taken := make(map[string]bool)
+	for _, name := range header {
+		taken[name] = true
+	}
+
+	var fix headerFix
+	done := make(map[string]bool)
+	for i, name := range header {
+		name = headerKey(name)
+		if !Include(dups, name) {
+			fix.names = append(fix.names, name)
+			fix.sources = append(fix.sources, []int{i})
+			continue
+		}
+
+		choice := choices[name]
+		if name == "" && choice == dupMerge {
+			choice = dupSuffix
+		}
+		switch choice {
+		case dupMerge:
+			if !done[name] {
+				fix.names = append(fix.names, name)
+				fix.sources = append(fix.sources, positions[name])
+			}
+		case dupDrop:
+			if !done[name] && name != "" {
+				fix.names = append(fix.names, name)
+				fix.sources = append(fix.sources, []int{i})
+			}
+		default:
+			newName := name
+			if name == "" {
+				newName = "Column " + strconv.Itoa(i+1)
+			} else if done[name] {
+				for n := 2; taken[newName]; n++ {
+					newName = name + " (" + strconv.Itoa(n) + ")"
+				}
+			}
+			taken[newName] = true
+			fix.names = append(fix.names, newName)
+			fix.sources = append(fix.sources, []int{i})
+		}
+		done[name] = true
+	}
+	return fix
+}
+
+// fixedReader applies a headerFix to every record
+type fixedReader struct {
+	r   recordReader
+	fix headerFix
+	out []string
+}
+
+func (fr *fixedReader) Read() ([]string, error) {
+	record, err := fr.r.Read()
+	if err != nil {
+		return record, err
+	}
+	if fr.out == nil {
+		fr.out = make([]string, len(fr.fix.names))
+	}
+	for i, sources := range fr.fix.sources {
+		if len(sources) == 1 {
+			fr.out[i] = record[sources[0]]
+			continue
+		}
+		// merged columns: keep each distinct value once
+		var values []string
+		for _, j := range sources {
+			if v := record[j]; v != "" && !Include(values, v) {
+				values = append(values, v)
+			}
+		}
+		fr.out[i] = strings.Join(values, mergeSeparator)
+	}
+	return fr.out, nil
+}
+
+// duplicateHelper is the interactive helper function that asks what
+// to do with each repeated or blank column name. Choices already in
+// choices are kept; if ask is false, the rest are numbered.
+func duplicateHelper(header []string, choices map[string]string, ask bool) map[string]string {
+	dups, positions := duplicateHeaders(header)
+	result := make(map[string]string)
+	for _, name := range dups {
+		if choice, ok := choices[name]; ok {
+			result[name] = choice
+		}
+	}
+
+	var columns []string
+	for _, name := range dups {
+		if _, ok := result[name]; ok {
+			continue
+		}
+		columns = columns[:0]
+		for _, i := range positions[name] {
+			columns = append(columns, strconv.Itoa(i+1))
+		}
+		if !ask {
+			if name == "" {
+				fmt.Printf("Blank column names (columns %v) are called \"Column <number>\"\n", strings.Join(columns, ", "))
+			} else {
+				fmt.Printf("The column name \"%v\" is used by columns %v; numbering the repeats\n", name, strings.Join(columns, ", "))
+			}
+			result[name] = dupSuffix
+			continue
+		}
+
+		PrintHLine(1)
+		if name == "" {
+			Prompt(false, `Some columns have no name (columns `+strings.Join(columns, ", ")+`). What would you like to do with them?
+1: keep them, named "Column <number>"
+2: drop them`)
+			PrintHLine(1)
+			switch inputNumber(1, 2, os.Stdin) {
+			case 2:
+				result[name] = dupDrop
+			default:
+				result[name] = dupSuffix
+			}
+			continue
+		}
+		Prompt(false, `The column name "`+name+`" is used by more than one column (columns `+strings.Join(columns, ", ")+`).
+Only one of them can keep the name. What would you like to do?
+1: keep them all, numbering the repeats ("`+name+` (2)", ...)
+2: merge them into one column (different values are joined with "`+mergeSeparator+`")
+3: keep the first column and drop the rest`)
+		PrintHLine(1)
+		switch inputNumber(1, 3, os.Stdin) {
+		case 2:
+			result[name] = dupMerge
+		case 3:
+			result[name] = dupDrop
+		default:
+			result[name] = dupSuffix
+		}
+	}
+	return result
+}
+
+// checkHeader reads the header of the input file and settles what to
+// do with repeated and blank column names, asking the user if ask is
+// true
+func checkHeader(filename string, in inputDialect, ask bool) map[string]string {
+	f, header, _ := openInput(filename, in)
+	f.Close()
+	return duplicateHelper(header, in.duplicates, ask)
+}
+
+// headerSample is how many rows are examined when looking for the header
+const headerSample = 20
+
+// detectHeader guesses which of the first rows of a file holds the
+// column names, skipping title lines and blank rows above it. It
+// returns the (1-based) row of the names and how many rows the header
+// takes up: 2 if the row above looks like group names for the columns.
+func detectHeader(rows [][]string) (int, int) {
+	filled := func(row []string) (text, numbers int) {
+		for _, field := range row {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if _, err := strconv.ParseFloat(field, 64); err == nil {
+				numbers++
+			} else {
+				text++
+			}
+		}
+		return text, numbers
+	}
+
+	widest := 0
+	for _, row := range rows {
+		if text, numbers := filled(row); text+numbers > widest {
+			widest = text + numbers
+		}
+	}
+	if widest < 2 {
+		return 1, 1
+	}
+
+	// the names fill most of the columns, and are words
+	for i, row := range rows {
+		text, numbers := filled(row)
+		if text+numbers < 2 || (text+numbers)*4 < widest*3 || numbers > text {
+			continue
+		}
+		if i == 0 {
+			return 1, 1
+		}
+		above, aboveNumbers := filled(rows[i-1])
+		if above >= 2 && aboveNumbers == 0 && above < text {
+			return i + 1, 2
+		}
+		return i + 1, 1
+	}
+	return 1, 1
+}
+
+// joinHeaderRows joins a header that takes up several rows into one
+// row of names. A group name above the columns is written in the
+// first cell of the group only, so it carries over to the blank cells
+// after it.
+func joinHeaderRows(rows [][]string) []string {
+	if len(rows) == 1 {
+		return rows[0]
+	}
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	names := make([]string, width)
+	for r, row := range rows {
+		group := ""
+		for i := 0; i < width; i++ {
+			value := ""
+			if i < len(row) {
+				value = strings.TrimSpace(row[i])
+			}
+			// only the group rows carry over
+			if r < len(rows)-1 {
+				if value != "" {
+					group = value
+				}
+				value = group
+			}
+			switch {
+			case value == "":
+			case names[i] == "":
+				names[i] = value
+			default:
+				names[i] += " " + value
+			}
+		}
+	}
+	return names
+}
+
+// headerHelper is the interactive helper function that settles where
+// the header is. The guess from detectHeader is used as it is when it
+// is simply the first row; otherwise the user is asked to confirm it.
+func headerHelper(filename string, in inputDialect) (int, int) {
+	// read the first rows as they are
+	raw := in
+	raw.headerRow, raw.headerRows = 1, 1
+	f, first, r := openInput(filename, raw)
+	defer f.Close()
+	rows := [][]string{first}
+	for len(rows) < headerSample {
+		record, err := r.Read()
+		if err != nil {
+			break
+		}
+		rows = append(rows, append([]string(nil), record...))
+	}
+
+	row, n := detectHeader(rows)
+	if row == 1 {
+		return row, n
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "The first rows of %v are:\n", filename)
+	for i, record := range rows {
+		if i > row+1 {
+			break
+		}
+		line := strings.Join(record, ", ")
+		if len(line) > 70 {
+			line = line[:70] + "..."
+		}
+		fmt.Fprintf(&b, "%v: %v\n", i+1, line)
+	}
+	fmt.Fprintf(&b, `Row %v looks like the column names, so the rows above it will be skipped.
+0: yes, row %v has the column names
+%v to %v: no, use this row instead`, row, row, 1, len(rows))
+	PrintHLine(1)
+	Prompt(false, b.String())
+	PrintHLine(1)
+	if choice := inputNumber(0, len(rows), os.Stdin); choice > 0 {
+		row, n = choice, 1
+	}
+	if row == 1 {
+		return row, 1
+	}
+	// only a row with something in it can hold group names
+	if strings.TrimSpace(strings.Join(rows[row-2], "")) == "" {
+		return row, 1
+	}
+
+	PrintHLine(1)
+	Prompt(false, fmt.Sprintf(`Does row %v hold group names for the columns below it (for example
+"Fracture" above "angle 1", "angle 2")?
+0: no
+1: yes, join them into one name ("Fracture angle 1")`, row-1))
+	PrintHLine(1)
+	if inputNumber(0, 1, os.Stdin) == 1 {
+		n = 2
+	} else {
+		n = 1
+	}
+	return row, n
+}
+
+// multiCloser closes several things in order, returning the first error
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var first error
+	for _, c := range m {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// openTable opens the input file like openInput, then fixes ragged
+// rows (see fitRows) and repeated or blank column names, so every
+// record matches the header it returns, and adds the columns of any
+// joined tables. The joins must have been loaded with loadJoins.
+// Closing the returned io.Closer finishes the rejects file, if there
+// is one, and reports on the joins.
+func openTable(filename string, in inputDialect, rejects string) (io.Closer, []string, recordReader) {
+	f, header, raw := openInput(filename, in)
+	rr := fitRows(raw, header, in.ragged, rejects)
+	fix := fixHeader(header, in.duplicates)
+	closers := multiCloser{rr}
+
+	header = fix.names
+	var r recordReader = &fixedReader{r: rr, fix: fix}
+	for _, j := range in.joins {
+		var jr *joinReader
+		header, jr = joinTable(header, r, j, rejects != "")
+		r = jr
+		closers = append(closers, jr)
+	}
+	return append(closers, f), header, r
+}
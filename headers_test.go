@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFixHeader(t *testing.T) {
+	header := []string{"Side", "Notes", "Side", "", "Notes"}
+	var fixTests = []struct {
+		choices map[string]string // what to do with each repeated name
+		names   []string          // output header
+		sources [][]int           // input fields of each output column
+	}{
+		{nil,
+			[]string{"Side", "Notes", "Side (2)", "Column 4", "Notes (2)"},
+			[][]int{{0}, {1}, {2}, {3}, {4}}},
+		{map[string]string{"Side": dupMerge, "": dupDrop, "Notes": dupDrop},
+			[]string{"Side", "Notes"},
+			[][]int{{0, 2}, {1}}},
+		{map[string]string{"Side": dupDrop, "": dupMerge, "Notes": dupMerge},
+			[]string{"Side", "Notes", "Column 4"},
+			[][]int{{0}, {1, 4}, {3}}},
+	}
+
+	for _, tt := range fixTests {
+		fix := fixHeader(header, tt.choices)
+		result, _ := json.Marshal([]interface{}{fix.names, fix.sources})
+		expected, _ := json.Marshal([]interface{}{tt.names, tt.sources})
+		if string(result) != string(expected) {
+			t.Errorf("fixHeader(%q, %v): expected %v, got %v", header, tt.choices, string(expected), string(result))
+		}
+	}
+}
+
+func TestFixedReader(t *testing.T) {
+	fix := headerFix{[]string{"Side", "Notes"}, [][]int{{0, 2}, {1}}}
+	r := &fixedReader{r: &rowsReader{[][]string{{"L", "a", "R"}, {"L", "b", "L"}, {"", "c", ""}}}, fix: fix}
+	expected := []string{`["L | R","a"]`, `["L","b"]`, `["","c"]`}
+	for _, e := range expected {
+		row, _ := r.Read()
+		if result, _ := json.Marshal(row); string(result) != e {
+			t.Errorf("fixedReader: expected %v, got %v", e, string(result))
+		}
+	}
+}
+
+func TestDetectHeader(t *testing.T) {
+	var detectTests = []struct {
+		rows       [][]string // first rows of the file
+		row, count int        // row of the names and rows in the header
+	}{
+		{[][]string{{"a", "b", "c"}, {"1", "2", "3"}}, 1, 1},
+		{[][]string{{"Olduvai specimens 2019", "", ""}, {"", "", ""}, {"Specimen", "Side", "Length"}, {"1", "L", "4.5"}}, 3, 1},
+		{[][]string{{"Olduvai specimens", "", "", ""}, {"", "Fracture", "", "Notch"}, {"Specimen", "angle 1", "angle 2", "type"}, {"1", "90", "45", "A"}}, 3, 2},
+		{[][]string{{"only"}, {"one column"}}, 1, 1},
+	}
+
+	for _, tt := range detectTests {
+		row, count := detectHeader(tt.rows)
+		if row != tt.row || count != tt.count {
+			t.Errorf("detectHeader(%q): expected %v, %v, got %v, %v", tt.rows, tt.row, tt.count, row, count)
+		}
+	}
+}
+
+func TestHeaderHelper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "DWCHelper-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+
+	var helperTests = []struct {
+		data  string // input file
+		group bool   // whether the user is asked about group names
+	}{
+		// a blank row above the names holds nothing to join
+		{"Specimens from FLK\n, ,\nID,Site,Notes\n1,FLK,x\n2,HWK,y\n", false},
+		{"Specimens from FLK\nsee notes\nID,Site,Notes\n1,FLK,x\n2,HWK,y\n", true},
+	}
+
+	for i, tt := range helperTests {
+		input := filepath.Join(dir, "in.csv")
+		ioutil.WriteFile(input, []byte(tt.data), 0644)
+		// accept the suggested row, and say no to group names
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WriteString("0\n0\n")
+		w.Close()
+		os.Stdin = r
+
+		var row, n int
+		out := capture(t, func() {
+			row, n = headerHelper(input, inputDialect{})
+		})
+		r.Close()
+		if row != 3 || n != 1 {
+			t.Errorf("headerHelper %v: expected row 3 of 1, got row %v of %v", i, row, n)
+		}
+		if group := strings.Contains(out, "group names"); group != tt.group {
+			t.Errorf("headerHelper %v: expected to ask about group names %v, got %v", i, tt.group, group)
+		}
+	}
+}
+
+func TestJoinHeaderRows(t *testing.T) {
+	rows := [][]string{{"", "Fracture", "", "Notch"}, {"Specimen", "angle 1", "angle 2", ""}}
+	result, _ := json.Marshal(joinHeaderRows(rows))
+	expected := `["Specimen","Fracture angle 1","Fracture angle 2","Notch"]`
+	if string(result) != expected {
+		t.Errorf("joinHeaderRows(%q): expected %v, got %v", rows, expected, string(result))
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// join links another table to the input on a key column, the way an
+// Access database links specimens to sites or excavation units. Each
+// input row gets the columns of the matching row of the joined table.
+type join struct {
+	file     string    // table to join
+	leftKey  string    // column of the input, or of an earlier join
+	rightKey string    // matching column of the joined table
+	table    *database // the joined table, once loadJoins has read it
+}
+
+// database holds a joined table, column by column
+type database struct {
+	data  map[string][]string // maps terms to data
+	terms []string            // ordered list of terms
+}
+
+// readTable reads a whole CSV file or workbook, read with the given
+// dialect, into a database
+func readTable(filename string, in inputDialect) database {
+	f, header, r := openTable(filename, in, "")
+	defer f.Close()
+
+	db := database{data: make(map[string][]string), terms: header}
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Println("Cannot read CSV data:", err.Error())
+			os.Exit(1)
+		}
+		for i, term := range db.terms {
+			db.data[term] = append(db.data[term], row[i])
+		}
+	}
+	return db
+}
+
+// parseJoin reads a -join option: "sites.csv", "sites.csv:SiteID" when
+// the key column has the same name in both tables, or
+// "sites.csv:Site=SiteID" when it doesn't. Missing keys are asked for.
+func parseJoin(s string) (join, error) {
+	var j join
+	j.file = s
+	// the colon of a Windows drive letter isn't a separator
+	if i := strings.LastIndex(s, ":"); i > 1 && !strings.ContainsAny(s[i:], `/\`) {
+		j.file = s[:i]
+		keys := strings.SplitN(s[i+1:], "=", 2)
+		j.leftKey = keys[0]
+		j.rightKey = keys[0]
+		if len(keys) == 2 {
+			j.rightKey = keys[1]
+		}
+	}
+	if j.file == "" {
+		return j, fmt.Errorf("'%s' doesn't name a file to join", s)
+	}
+	return j, nil
+}
+
+// joinList collects repeated -join options
+type joinList []join
+
+func (l *joinList) String() string {
+	var s []string
+	for _, j := range *l {
+		s = append(s, j.file)
+	}
+	return strings.Join(s, ", ")
+}
+
+func (l *joinList) Set(s string) error {
+	j, err := parseJoin(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, j)
+	return nil
+}
+
+// savedJoins returns joins with each file given relative to the
+// folder of input, as they are saved in its settings, so that the
+// settings still work when DWCHelper is run from another folder
+func savedJoins(input string, joins []join) []join {
+	var saved []join
+	dir, _ := filepath.Abs(filepath.Dir(input))
+	for _, j := range joins {
+		file, _ := filepath.Abs(j.file)
+		if rel, err := filepath.Rel(dir, file); err == nil {
+			j.file = filepath.ToSlash(rel)
+		}
+		saved = append(saved, j)
+	}
+	return saved
+}
+
+// resolveJoins undoes savedJoins, for the joins in the settings of
+// input
+func resolveJoins(input string, joins []join) []join {
+	var resolved []join
+	for _, j := range joins {
+		if j.file = filepath.FromSlash(j.file); !filepath.IsAbs(j.file) {
+			j.file = filepath.Join(filepath.Dir(input), j.file)
+		}
+		resolved = append(resolved, j)
+	}
+	return resolved
+}
+
+// loadJoins reads each joined table into a database and makes sure
+// both key columns are known, asking the user to pick them if they
+// aren't. header is the input's header; each join can use the columns
+// of the joins before it.
+func loadJoins(header []string, joins []join, given inputDialect) []join {
+	var loaded []join
+	for _, j := range joins {
+		in := inputDialect{encoding: given.encoding, ragged: given.ragged}
+		in = sniffDialect(j.file, in)
+		in.duplicates = checkHeader(j.file, in, false)
+		db := readTable(j.file, in)
+		j.table = &db
+
+		if !Include(header, j.leftKey) || !Include(db.terms, j.rightKey) {
+			if j.leftKey != "" {
+				fmt.Printf("Cannot join %v on \"%v\" = \"%v\": no such column\n", j.file, j.leftKey, j.rightKey)
+			}
+			j.leftKey, j.rightKey = keyHelper(header, db.terms, j.file)
+		}
+		loaded = append(loaded, j)
+		header, _ = joinedColumns(header, j)
+	}
+	return loaded
+}
+
+// keyHelper is the interactive helper function that asks which
+// columns link the input to a joined table
+func keyHelper(left, right []string, file string) (string, string) {
+	// a column with the same name in both tables is the likely key
+	suggestion := ""
+	for _, term := range right {
+		if Include(left, term) {
+			suggestion = term
+			break
+		}
+	}
+
+	choose := func(terms []string, message string) string {
+		var b strings.Builder
+		fmt.Fprintln(&b, message)
+		for i, term := range terms {
+			fmt.Fprintf(&b, " %v: \"%v\"", i+1, term)
+			if term == suggestion {
+				fmt.Fprint(&b, " <===SUGGESTED")
+			}
+			if i%3 == 2 {
+				fmt.Fprintln(&b)
+			}
+		}
+		PrintHLine(1)
+		Prompt(false, b.String())
+		PrintHLine(1)
+		n := inputNumber(1, len(terms), os.Stdin)
+		if n == 0 {
+			fmt.Println("No key column chosen, giving up")
+			os.Exit(1)
+		}
+		return terms[n-1]
+	}
+	leftKey := choose(left, "Which column of your data links each row to "+file+"?")
+	rightKey := choose(right, "Which column of "+file+" holds the matching values?")
+	return leftKey, rightKey
+}
+
+// joinedColumns returns header with the columns of the joined table
+// added, along with their positions in the joined table. The joined
+// table's key is left out, since it repeats the input's key; names
+// that are already taken get the table's name in front.
+func joinedColumns(header []string, j join) ([]string, []int) {
+	prefix := strings.TrimSuffix(filepath.Base(j.file), filepath.Ext(j.file))
+	out := append([]string(nil), header...)
+	var columns []int
+	for i, term := range j.table.terms {
+		if term == j.rightKey {
+			continue
+		}
+		name := term
+		if Include(out, name) {
+			name = prefix + "." + term
+		}
+		for n := 2; Include(out, name); n++ {
+			name = prefix + "." + term + " (" + strconv.Itoa(n) + ")"
+		}
+		out = append(out, name)
+		columns = append(columns, i)
+	}
+	return out, columns
+}
+
+// joinReader adds the columns of a joined table to every record
+type joinReader struct {
+	r         recordReader
+	j         join
+	key       int            // position of the key in the input record
+	columns   []int          // columns of the joined table to add
+	rows      map[string]int // joined table rows by key
+	out       []string
+	report    bool // whether Close sums up
+	n         int  // records read
+	unmatched int  // records with no matching row
+}
+
+// joinTable wraps r, whose records match header, so that each record
+// gets the matching columns of the joined table
+func joinTable(header []string, r recordReader, j join, report bool) ([]string, *joinReader) {
+	out, columns := joinedColumns(header, j)
+	jr := &joinReader{r: r, j: j, key: Index(header, j.leftKey), columns: columns, report: report}
+
+	// index the joined table by its key; the first row wins
+	jr.rows = make(map[string]int)
+	repeated := 0
+	for i, value := range j.table.data[j.rightKey] {
+		if value == "" {
+			continue
+		}
+		if _, ok := jr.rows[value]; ok {
+			repeated++
+			continue
+		}
+		jr.rows[value] = i
+	}
+	if report && repeated > 0 {
+		fmt.Printf("%v rows of %v repeat a \"%v\" value; only the first of each is used\n", repeated, j.file, j.rightKey)
+	}
+	return out, jr
+}
+
+func (jr *joinReader) Read() ([]string, error) {
+	record, err := jr.r.Read()
+	if err != nil {
+		return record, err
+	}
+	jr.n++
+	jr.out = append(jr.out[:0], record...)
+	row, ok := jr.rows[record[jr.key]]
+	if !ok {
+		jr.unmatched++
+	}
+	for _, c := range jr.columns {
+		value := ""
+		if ok {
+			value = jr.j.table.data[jr.j.table.terms[c]][row]
+		}
+		jr.out = append(jr.out, value)
+	}
+	return jr.out, nil
+}
+
+// Close sums up how many rows found no match
+func (jr *joinReader) Close() error {
+	if jr.report && jr.unmatched > 0 {
+		fmt.Printf("%v of %v rows have no match in %v on \"%v\", so the columns from %v are empty for them\n",
+			jr.unmatched, jr.n, jr.j.file, jr.j.leftKey, jr.j.file)
+	}
+	return nil
+}
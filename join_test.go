@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseJoin(t *testing.T) {
+	var parseTests = []struct {
+		s        string // -join option
+		file     string // table to join
+		leftKey  string // input column
+		rightKey string // joined column
+	}{
+		{"sites.csv", "sites.csv", "", ""},
+		{"sites.csv:SiteID", "sites.csv", "SiteID", "SiteID"},
+		{"sites.csv:Site=SiteID", "sites.csv", "Site", "SiteID"},
+		{`C:\data\sites.csv`, `C:\data\sites.csv`, "", ""},
+		{`C:\data\sites.csv:Site=ID`, `C:\data\sites.csv`, "Site", "ID"},
+	}
+
+	for _, tt := range parseTests {
+		j, err := parseJoin(tt.s)
+		if err != nil || j.file != tt.file || j.leftKey != tt.leftKey || j.rightKey != tt.rightKey {
+			t.Errorf("parseJoin(%q): expected %v %v %v, got %v %v %v (%v)", tt.s, tt.file, tt.leftKey, tt.rightKey, j.file, j.leftKey, j.rightKey, err)
+		}
+	}
+}
+
+func TestSavedJoins(t *testing.T) {
+	var savedTests = []struct {
+		input string // input file
+		file  string // joined table, relative to the working folder
+		saved string // as saved in the input's settings
+	}{
+		{"specimens.csv", "sites.csv", "sites.csv"},
+		{"data/specimens.csv", "data/sites.csv", "sites.csv"},
+		{"data/specimens.csv", "tables/sites.csv", "../tables/sites.csv"},
+		{"specimens.csv", "data/sites.csv", "data/sites.csv"},
+	}
+
+	for _, tt := range savedTests {
+		input := filepath.FromSlash(tt.input)
+		joins := []join{{file: filepath.FromSlash(tt.file), leftKey: "Site"}}
+		saved := savedJoins(input, joins)
+		if saved[0].file != tt.saved || saved[0].leftKey != "Site" {
+			t.Errorf("savedJoins(%v, %v): expected %v, got %v", tt.input, tt.file, tt.saved, saved[0].file)
+		}
+		if file := resolveJoins(input, saved)[0].file; file != joins[0].file {
+			t.Errorf("resolveJoins(%v, %v): expected %v, got %v", tt.input, tt.saved, joins[0].file, file)
+		}
+	}
+}
+
+// sites is a joined table, as loadJoins reads it
+var sites = join{file: "data/sites.csv", leftKey: "Site", rightKey: "SiteID", table: &database{
+	terms: []string{"SiteID", "Name", "Notes"},
+	data: map[string][]string{
+		"SiteID": {"FLK", "HWK", "FLK", ""},
+		"Name":   {"Frida Leakey Korongo", "Henrietta Wilfrida Korongo", "repeated", "no key"},
+		"Notes":  {"Bed I", "", "repeated", ""},
+	},
+}}
+
+func TestJoinedColumns(t *testing.T) {
+	var columnTests = []struct {
+		header  []string
+		out     []string
+		columns []int
+	}{
+		{[]string{"ID", "Site"}, []string{"ID", "Site", "Name", "Notes"}, []int{1, 2}},
+		// names already taken get the table's name in front
+		{[]string{"ID", "Site", "Notes"}, []string{"ID", "Site", "Notes", "Name", "sites.Notes"}, []int{1, 2}},
+		{[]string{"Site", "Notes", "sites.Notes"}, []string{"Site", "Notes", "sites.Notes", "Name", "sites.Notes (2)"}, []int{1, 2}},
+	}
+
+	for _, tt := range columnTests {
+		out, columns := joinedColumns(tt.header, sites)
+		result, _ := json.Marshal([]interface{}{out, columns})
+		expected, _ := json.Marshal([]interface{}{tt.out, tt.columns})
+		if string(result) != string(expected) {
+			t.Errorf("joinedColumns(%v): expected %v, got %v", tt.header, string(expected), string(result))
+		}
+	}
+}
+
+func TestJoinReader(t *testing.T) {
+	rows := [][]string{{"1", "FLK"}, {"2", "MNK"}, {"3", "HWK"}, {"4", ""}}
+	_, jr := joinTable([]string{"ID", "Site"}, &rowsReader{rows}, sites, false)
+
+	// the first row of a repeated key wins, and records without a
+	// match get empty columns
+	expected := [][]string{
+		{"1", "FLK", "Frida Leakey Korongo", "Bed I"},
+		{"2", "MNK", "", ""},
+		{"3", "HWK", "Henrietta Wilfrida Korongo", ""},
+		{"4", "", "", ""},
+	}
+	for _, e := range expected {
+		row, err := jr.Read()
+		result, _ := json.Marshal(row)
+		want, _ := json.Marshal(e)
+		if err != nil || string(result) != string(want) {
+			t.Errorf("joinReader: expected %v, got %v (%v)", string(want), string(result), err)
+		}
+	}
+	if jr.n != 4 || jr.unmatched != 2 {
+		t.Errorf("joinReader: expected 4 records and 2 unmatched, got %v and %v", jr.n, jr.unmatched)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readLegacySettings reads a settings file in the CSV format used
+// before settingsVersion 1.
+//
+// The first line is a list of terms to remove; every line after it
+// maps a term (first value) to its new name (second value). Lines
+// starting with @ are options instead, such as "@delimiter,semicolon".
+func readLegacySettings(f io.Reader) settings {
+	var s settings
+	r := csv.NewReader(f)
+	r.LazyQuotes = true
+
+	// .settings file is not "square"
+	r.FieldsPerRecord = -1
+
+	// remove terms
+	termsToRemove, err := r.Read()
+	if err != nil && err != io.EOF {
+		fmt.Println("Cannot read CSV data for terms to remove in the settings file:", err.Error())
+		os.Exit(1)
+	}
+
+	// an empty list of removals is written as a blank line, which
+	// the CSV reader skips, so the first record may already be an alias
+	if err == nil {
+		if line, _ := r.FieldPos(0); line > 1 {
+			s.rename = append(s.rename, termsToRemove)
+			termsToRemove = nil
+		}
+	}
+	for _, term := range termsToRemove {
+		if term != "" {
+			s.remove = append(s.remove, term)
+		}
+	}
+
+	// rename the rest
+	rows, err := r.ReadAll()
+	if err != nil {
+		fmt.Println("Cannot read CSV data for aliases in the settings file:", err.Error())
+		os.Exit(1)
+	}
+	s.rename = append(s.rename, rows...)
+
+	// ignore aliases without a new name
+	var aliases [][]string
+	for _, row := range s.rename {
+		switch {
+		case len(row) < 2:
+		case strings.HasPrefix(row[0], "@"):
+			s.setOption(row)
+		default:
+			aliases = append(aliases, row[:2])
+		}
+	}
+	s.rename = aliases
+	return s
+}
+
+// setOption applies one "@name,value" line of the settings file.
+// Unknown options are ignored so that newer settings files still load.
+func (s *settings) setOption(row []string) {
+	name, value := row[0], row[1]
+	var err error
+	switch name {
+	case "@delimiter":
+		s.dialect.delimiter, err = parseDelimiter(value)
+	case "@quote":
+		s.dialect.quote, err = parseQuote(value)
+	case "@sheet":
+		s.dialect.sheet = value
+	case "@header":
+		// @header,<row of the column names>[,<rows to join>]
+		s.dialect.headerRow, err = strconv.Atoi(value)
+		s.dialect.headerRows = 1
+		if err == nil && len(row) > 2 {
+			s.dialect.headerRows, err = strconv.Atoi(row[2])
+		}
+	case "@duplicate":
+		// @duplicate,<column name>,<suffix|merge|drop>
+		if len(row) < 3 || !Include([]string{dupSuffix, dupMerge, dupDrop}, row[2]) {
+			err = fmt.Errorf("expected @duplicate,<column name>,<suffix|merge|drop>")
+			break
+		}
+		if s.dialect.duplicates == nil {
+			s.dialect.duplicates = make(map[string]string)
+		}
+		s.dialect.duplicates[value] = row[2]
+	case "@join":
+		// @join,<file>,<input column>,<joined column>
+		if len(row) < 4 {
+			err = fmt.Errorf("expected @join,<file>,<input column>,<joined column>")
+			break
+		}
+		s.dialect.joins = append(s.dialect.joins, join{file: value, leftKey: row[2], rightKey: row[3]})
+	case "@output-delimiter", "@line-ending", "@quoting", "@bom", "@header-case", "@order", "@dynamic-properties":
+		err = s.output.set(name[1:], value)
+	case "@namespace":
+		s.namespace = value
+	case "@title":
+		s.meta.title = value
+	case "@abstract":
+		s.meta.abstract = value
+	case "@creator":
+		// @creator,<name>[,<organisation>[,<email>]]
+		c := creator{name: value}
+		if len(row) > 2 {
+			c.organisation = row[2]
+		}
+		if len(row) > 3 {
+			c.email = row[3]
+		}
+		s.meta.creators = append(s.meta.creators, c)
+	case "@license":
+		s.meta.license = value
+	case "@geography":
+		s.meta.geography = value
+	}
+	if err != nil {
+		fmt.Println("Ignoring", name, "in the settings file:", err.Error())
+	}
+}
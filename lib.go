@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"time"
 	"strings"
-	"github.com/fatih/camelcase"
 )
 
 const termURL string = "https://raw.githubusercontent.com/tdwg/dwc/master/dist/simple_dwc_horizontal.csv"
@@ -120,42 +119,6 @@ func PrintHLine(i int) {
 }
 
 
-// notAllSame returns true if not every element of a string slice is the same
-func notAllSame(s []string) bool {
-	for i := 0; i < len(s); i++ {
-		if s[i] != s[0] {
-			return true
-		}
-	}
-	return false
-}
-
-// stringIsVariation is a loose matching function to determine if a
-// string could be a variation of a term in camelCase
-func stringIsVariation(s string, t string) bool {
-
-	words := camelcase.Split(t)
-	
-	switch {
-	case s == strings.ToLower(strings.Join(words, " ")):
-		return true
-	case s == strings.Title(strings.Join(words, " ")):
-		return true
-	}
-
-	stringWords := strings.Split(s, " ")
-
-	for _, x := range stringWords {
-		for _, y := range words {
-			if strings.ToLower(x) == strings.ToLower(y) {
-				return true
-			}
-		}
-	}
-
-	return false
-}
-
 // inputTerm gets a new term from the user
 func inputTerm(message string, r io.Reader) string {
 	fmt.Print(message)
@@ -164,3 +127,35 @@ func inputTerm(message string, r io.Reader) string {
 	fmt.Println()
 	return b.Text()
 }
+
+// inputDWCTerm gets a new term from the user, checked against the
+// Darwin Core terms dwc. A name that isn't a term gets a list of the
+// terms it may be short for or a typo of, and is only used as it is if
+// the user says so. An empty answer is returned as it is.
+func inputDWCTerm(message string, dwc []string, r io.Reader) string {
+	for {
+		text := strings.TrimSpace(inputTerm(message, r))
+		if text == "" || termIRI(text, dwc) != "" {
+			return text
+		}
+		matches := completeTerm(text, dwc)
+		fmt.Printf("\"%v\" isn't a Darwin Core term.", text)
+		if len(matches) > 0 {
+			fmt.Print(" Did you mean:")
+		}
+		fmt.Println()
+		for i, term := range matches {
+			fmt.Printf("%v: %v\n", i+1, term)
+		}
+		fmt.Printf("%v: use \"%v\" anyway\n", len(matches)+1, text)
+		fmt.Println("0: type the name again")
+		switch n := inputNumber(0, len(matches)+1, r); {
+		case n == 0:
+			continue
+		case n <= len(matches):
+			return matches[n-1]
+		default:
+			return text
+		}
+	}
+}
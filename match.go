@@ -0,0 +1,243 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/camelcase"
+)
+
+// maxSuggestions is how many suggestions showTerms lists for a column
+const maxSuggestions = 3
+
+// minScore is the lowest score worth suggesting
+const minScore = 0.4
+
+// candidate is a term suggested for a column, with a score from 0 to 1
+// for how well it matches
+type candidate struct {
+	term    string
+	score   float64
+	byValue bool // suggested by the column's values, see contentTerms
+}
+
+// expansions spells out the abbreviations and synonyms that turn up in
+// column names, as the words of the Darwin Core terms they stand for
+var expansions = map[string][]string{
+	"lat":       {"latitude"},
+	"long":      {"longitude"},
+	"lon":       {"longitude"},
+	"lng":       {"longitude"},
+	"no":        {"number"},
+	"nr":        {"number"},
+	"num":       {"number"},
+	"catalogue": {"catalog"},
+	"cat":       {"catalog"},
+	"species":   {"scientific", "name"},
+	"sci":       {"scientific"},
+	"loc":       {"locality"},
+	"site":      {"locality"},
+	"elev":      {"elevation"},
+	"alt":       {"elevation"},
+	"altitude":  {"elevation"},
+	"coll":      {"collection"},
+	"collector": {"recorded", "by"},
+	"det":       {"identified", "by"},
+	"notes":     {"remarks"},
+	"note":      {"remarks"},
+	"comments":  {"remarks"},
+	"comment":   {"remarks"},
+	"qty":       {"quantity"},
+	"prep":      {"preparations"},
+	"yr":        {"year"},
+	"mo":        {"month"},
+	"inst":      {"institution"},
+	"ref":       {"references"},
+	"refs":      {"references"},
+}
+
+// words splits a column name or term into lower case words: at spaces
+// and punctuation, and between the words of camel case
+func words(s string) []string {
+	var result []string
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		for _, w := range camelcase.Split(field) {
+			result = append(result, strings.ToLower(w))
+		}
+	}
+	return result
+}
+
+// expand replaces the abbreviations and synonyms in words
+func expand(words []string) []string {
+	var result []string
+	for _, w := range words {
+		if e, ok := expansions[w]; ok {
+			result = append(result, e...)
+		} else {
+			result = append(result, w)
+		}
+	}
+	return result
+}
+
+// levenshtein returns the number of single character edits that turn
+// a into b
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := range s {
+		cur := make([]int, len(t)+1)
+		cur[0] = i + 1
+		for j := range t {
+			cost := 1
+			if s[i] == t[j] {
+				cost = 0
+			}
+			cur[j+1] = prev[j] + cost
+			if prev[j+1]+1 < cur[j+1] {
+				cur[j+1] = prev[j+1] + 1
+			}
+			if cur[j]+1 < cur[j+1] {
+				cur[j+1] = cur[j] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(t)]
+}
+
+// similarity is 1 minus the edit distance between a and b, relative to
+// the longer of the two
+func similarity(a, b string) float64 {
+	longest := len([]rune(a))
+	if n := len([]rune(b)); n > longest {
+		longest = n
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+// sameWord allows for typos and short forms: words match if they are
+// equal, one letter apart, or one is the first three or four letters
+// of the other
+func sameWord(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	switch {
+	case a == b:
+		return true
+	case len(a) >= 5 && levenshtein(a, b) <= 1:
+		return true
+	case len(a) >= 3 && len(a) <= 4 && strings.HasPrefix(b, a):
+		return true
+	}
+	return false
+}
+
+// overlap is the share of words in common between two lists of words
+// (their Dice coefficient), from 0 to 1
+func overlap(a, b []string) float64 {
+	if len(a)+len(b) == 0 {
+		return 0
+	}
+	used := make([]bool, len(b))
+	n := 0
+	for _, x := range a {
+		for j, y := range b {
+			if !used[j] && sameWord(x, y) {
+				used[j] = true
+				n++
+				break
+			}
+		}
+	}
+	return 2 * float64(n) / float64(len(a)+len(b))
+}
+
+// matchScore rates how well the column name matches name, a term or
+// an alias, from 0 to 1. Names that are the same but for case and
+// punctuation score 1; otherwise the words they share, after spelling
+// out the abbreviations in the column name, count most and the
+// spelling of the whole name breaks ties.
+func matchScore(column, name string) float64 {
+	a, b := words(column), words(name)
+	joinedA, joinedB := strings.Join(a, ""), strings.Join(b, "")
+	if joinedA == joinedB {
+		return 1
+	}
+	expanded := expand(a)
+	if strings.Join(expanded, "") == joinedB {
+		return 0.95
+	}
+	return 0.7*overlap(expanded, b) + 0.3*similarity(joinedA, joinedB)
+}
+
+// rankTerms returns the terms that may suit a column, best first: the
+// Darwin Core terms dwc that match its name, and the terms of aliases
+// (rows of a term and the column names used for it) whose names do.
+// Alias matches count a little less than matching the term itself.
+func rankTerms(column string, dwc []string, aliases [][]string) []candidate {
+	scores := make(map[string]float64)
+	for _, term := range dwc {
+		scores[term] = matchScore(column, term)
+	}
+	for _, row := range aliases {
+		for _, alias := range row[1:] {
+			if score := 0.9 * matchScore(column, alias); score > scores[row[0]] {
+				scores[row[0]] = score
+			}
+		}
+	}
+
+	var ranked []candidate
+	for term, score := range scores {
+		if score >= minScore {
+			ranked = append(ranked, candidate{term: term, score: score})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].term < ranked[j].term
+	})
+	return ranked
+}
+
+// maxCompletions is how many terms completeTerm offers
+const maxCompletions = 5
+
+// completeTerm returns the terms of dwc the user may have meant by
+// text: first those that start with it (ignoring case), then the
+// closest matches by matchScore
+func completeTerm(text string, dwc []string) []string {
+	var matches []string
+	lower := strings.ToLower(text)
+	for _, term := range dwc {
+		if strings.HasPrefix(strings.ToLower(term), lower) {
+			matches = append(matches, term)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return len(matches[i]) < len(matches[j])
+	})
+	for _, c := range rankTerms(text, dwc, nil) {
+		if !Include(matches, c.term) {
+			matches = append(matches, c.term)
+		}
+	}
+	if len(matches) > maxCompletions {
+		matches = matches[:maxCompletions]
+	}
+	return matches
+}
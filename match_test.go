@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRankTerms(t *testing.T) {
+	dwc := []string{"catalogNumber", "recordNumber", "scientificName", "vernacularName", "decimalLatitude", "verbatimLatitude", "locality", "eventDate", "year", "country", "countryCode", "individualCount", "recordedBy"}
+	aliases := [][]string{{"catalogNumber", "catalogueNumber"}, {"recordNumber", "specimenNumber"}}
+	var rankTests = []struct {
+		column string
+		best   string // "" for no suggestions
+	}{
+		{"Species", "scientificName"},
+		{"Skeletal portion", ""},
+		{"Lat", "decimalLatitude"},
+		{"Cat. No.", "catalogNumber"},
+		{"catalogNumer", "catalogNumber"},
+		{"Specimen number", "recordNumber"},
+		{"Country", "country"},
+		{"Collector", "recordedBy"},
+		{"Date", "eventDate"},
+	}
+
+	for _, tt := range rankTests {
+		ranked := rankTerms(tt.column, dwc, aliases)
+		best := ""
+		if len(ranked) > 0 {
+			best = ranked[0].term
+		}
+		if best != tt.best {
+			t.Errorf("rankTerms(%v): expected %q first, got %v", tt.column, tt.best, ranked)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	// "Country" is a word of individualCount only by its first letters
+	if country, count := matchScore("Country", "countryCode"), matchScore("Country", "individualCount"); country <= count {
+		t.Errorf("matchScore: expected countryCode (%v) above individualCount (%v)", country, count)
+	}
+	if score := matchScore("catalog_number", "catalogNumber"); score != 1 {
+		t.Errorf("matchScore(catalog_number, catalogNumber): expected 1, got %v", score)
+	}
+}
+
+func TestCompleteTerm(t *testing.T) {
+	dwc := []string{"catalogNumber", "recordNumber", "decimalLatitude", "decimalLongitude", "verbatimLatitude", "locality", "eventDate"}
+	var completeTests = []struct {
+		text string
+		out  []string
+	}{
+		{"decimalLat", []string{"decimalLatitude", "decimalLongitude", "verbatimLatitude"}},
+		{"DECIMAL", []string{"decimalLatitude", "decimalLongitude"}},
+		{"catalogNumer", []string{"catalogNumber", "recordNumber"}},
+		{"xyz", nil},
+	}
+
+	for _, tt := range completeTests {
+		result, _ := json.Marshal(completeTerm(tt.text, dwc))
+		expected, _ := json.Marshal(tt.out)
+		if string(result) != string(expected) {
+			t.Errorf("completeTerm(%v): expected %v, got %v", tt.text, string(expected), string(result))
+		}
+	}
+}
+
+// lineReader gives one line of a script per Read, the way a terminal
+// does, since each prompt reads the answer with a scanner of its own
+type lineReader struct {
+	lines []string
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	if len(r.lines) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.lines[0]+"\n")
+	r.lines = r.lines[1:]
+	return n, nil
+}
+
+func TestInputDWCTerm(t *testing.T) {
+	dwc := []string{"catalogNumber", "recordNumber", "locality"}
+	var inputTests = []struct {
+		answers string // lines typed by the user
+		term    string // term returned
+	}{
+		{"catalogNumber", "catalogNumber"},
+		{" locality ", "locality"},
+		{"modified", "modified"},
+		{"", ""},
+		// a typo gets suggestions to pick from
+		{"catalogNumer\n1", "catalogNumber"},
+		{"catalogNumer\n2", "recordNumber"},
+		{"catalogNumer\n3", "catalogNumer"},
+		{"catalogNumer\n7\n1", "catalogNumber"},
+		// or the name can be typed again, and is checked again
+		{"catalogNumer\n0\ncatalogNumbr\n1", "catalogNumber"},
+		{"catalogNumer\n0\nBone type\n1", "Bone type"},
+		// a name with no suggestions only needs confirming
+		{"xyz\n1", "xyz"},
+		// the input ending gives no term
+		{"catalogNumer", ""},
+	}
+
+	for _, tt := range inputTests {
+		r := &lineReader{strings.Split(tt.answers, "\n")}
+		if term := inputDWCTerm("New name? ", dwc, r); term != tt.term {
+			t.Errorf("inputDWCTerm with answers %q: expected %q, got %q", tt.answers, tt.term, term)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// mergeReader reads the inputs one after another, each converted with
+// its own settings, and hands back their records lined up with the
+// combined header from mergeInputs
+type mergeReader struct {
+	inputs   []string
+	all      []settings
+	rejects  string         // output file name, for the rejects files
+	position map[string]int // column of each term in the combined header
+	source   string         // term recording the input file, if any
+	open     tableOpener    // opens each input, see openTable
+
+	i     int // input being read
+	f     io.Closer
+	r     recordReader
+	terms []string
+	index []int
+	n     int // records read from the current input
+	out   []string
+}
+
+// mergeInputs opens the input files for merging. The combined header
+// has every column found in any of the inputs, in the order they
+// first appear; an input without a column leaves it empty. If source
+// is not empty, that column records which input each row came from.
+// Rejected rows go to files named after output, unless output is
+// empty. The caller must close the returned io.Closer.
+func mergeInputs(output string, inputs []string, all []settings, source string) ([]string, *mergeReader) {
+	return mergeTables(output, inputs, all, source, openTable)
+}
+
+// tableOpener opens an input file the way openTable does
+type tableOpener func(filename string, in inputDialect, rejects string) (io.Closer, []string, recordReader)
+
+// mergeTables is mergeInputs with the inputs opened by open
+func mergeTables(output string, inputs []string, all []settings, source string, open tableOpener) ([]string, *mergeReader) {
+	// work out the combined header before reading any data
+	var union []string
+	position := make(map[string]int)
+	add := func(term string) {
+		if _, ok := position[term]; !ok {
+			position[term] = len(union)
+			union = append(union, term)
+		}
+	}
+	for i, input := range inputs {
+		f, header, _ := open(input, all[i].dialect, "")
+		f.Close()
+		terms, _ := all[i].plan(header)
+		for _, term := range terms {
+			add(term)
+		}
+	}
+	if source != "" {
+		add(source)
+	}
+
+	mr := &mergeReader{inputs: inputs, all: all, rejects: output, position: position, source: source, open: open, i: -1}
+	mr.out = make([]string, len(union))
+	return union, mr
+}
+
+// next finishes the current input and opens the one after it,
+// returning false when there are no more
+func (mr *mergeReader) next() bool {
+	if err := mr.Close(); err != nil {
+		fmt.Println("Cannot save rejected rows:", err.Error())
+		exit(1)
+	}
+	mr.i++
+	if mr.i >= len(mr.inputs) {
+		return false
+	}
+	input := mr.inputs[mr.i]
+	rejects := ""
+	if mr.rejects != "" {
+		rejects = mr.rejects + "." + filepath.Base(input) + ".rejects.csv"
+	}
+	var header []string
+	mr.f, header, mr.r = mr.open(input, mr.all[mr.i].dialect, rejects)
+	mr.terms, mr.index = mr.all[mr.i].plan(header)
+	mr.n = 0
+	return true
+}
+
+func (mr *mergeReader) Read() ([]string, error) {
+	for {
+		if mr.r != nil {
+			record, err := mr.r.Read()
+			if err == nil {
+				mr.n++
+				return mr.line(record), nil
+			}
+			if err != io.EOF {
+				return nil, fmt.Errorf("%s: %s", mr.inputs[mr.i], err.Error())
+			}
+		}
+		if !mr.next() {
+			return nil, io.EOF
+		}
+	}
+}
+
+// line lines a record of the current input up with the combined header
+func (mr *mergeReader) line(record []string) []string {
+	for j := range mr.out {
+		mr.out[j] = ""
+	}
+	for j, term := range mr.terms {
+		mr.out[mr.position[term]] = record[mr.index[j]]
+	}
+	// keep a value the input already had for the source term
+	if mr.source != "" && mr.out[mr.position[mr.source]] == "" {
+		input := mr.inputs[mr.i]
+		mr.out[mr.position[mr.source]] = strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	}
+	return mr.out
+}
+
+// Close finishes the input being read, if any
+func (mr *mergeReader) Close() error {
+	if mr.f == nil {
+		return nil
+	}
+	fmt.Printf("Merged %v records from %v\n", mr.n, mr.inputs[mr.i])
+	err := mr.f.Close()
+	mr.f, mr.r = nil, nil
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestMergeReader(t *testing.T) {
+	// each input is a header and its rows
+	tables := map[string][][]string{
+		"data/a.csv": {{"ID", "Site"}, {"1", "FLK"}, {"2", "HWK"}},
+		"data/b.csv": {{"ID", "Depth", "source"}, {"3", "4.5", ""}, {"4", "2", "field book"}},
+		"data/c.csv": {{"Site", "ID"}, {"MNK", "5"}},
+	}
+	open := func(filename string, in inputDialect, rejects string) (io.Closer, []string, recordReader) {
+		rows := tables[filename]
+		return ioutil.NopCloser(nil), rows[0], &rowsReader{append([][]string(nil), rows[1:]...)}
+	}
+	id := settings{rename: [][]string{{"ID", "occurrenceID"}}}
+
+	var mergeTests = []struct {
+		inputs []string
+		all    []settings
+		source string
+		header []string
+		rows   [][]string
+	}{
+		// columns in the order they first appear, placed by name, and
+		// left empty for inputs without them
+		{[]string{"data/a.csv", "data/c.csv"}, []settings{id, id}, "",
+			[]string{"occurrenceID", "Site"},
+			[][]string{{"1", "FLK"}, {"2", "HWK"}, {"5", "MNK"}}},
+		{[]string{"data/a.csv", "data/b.csv", "data/c.csv"}, []settings{id, {remove: []string{"source"}}, id}, "",
+			[]string{"occurrenceID", "Site", "ID", "Depth"},
+			[][]string{{"1", "FLK", "", ""}, {"2", "HWK", "", ""}, {"", "", "3", "4.5"}, {"", "", "4", "2"}, {"5", "MNK", "", ""}}},
+		// the source column keeps values the input already had
+		{[]string{"data/a.csv", "data/b.csv"}, []settings{id, id}, "source",
+			[]string{"occurrenceID", "Site", "Depth", "source"},
+			[][]string{{"1", "FLK", "", "a"}, {"2", "HWK", "", "a"}, {"3", "", "4.5", "b"}, {"4", "", "2", "field book"}}},
+	}
+
+	for _, tt := range mergeTests {
+		header, mr := mergeTables("", tt.inputs, tt.all, tt.source, open)
+		var rows [][]string
+		for {
+			row, err := mr.Read()
+			if err != nil {
+				break
+			}
+			rows = append(rows, append([]string(nil), row...))
+		}
+		result, _ := json.Marshal([]interface{}{header, rows})
+		expected, _ := json.Marshal([]interface{}{tt.header, tt.rows})
+		if string(result) != string(expected) {
+			t.Errorf("merging %v: expected %v, got %v", strings.Join(tt.inputs, ", "), string(expected), string(result))
+		}
+	}
+}
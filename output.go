@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Quoting policies for CSV output
+const (
+	quoteMinimal = "minimal" // quote fields only when they need it
+	quoteAll     = "all"     // quote every field
+)
+
+// Column orders of the output
+const (
+	orderInput   = "input"    // as in the input
+	orderDWC     = "dwc"      // Darwin Core terms in the official order, then the rest
+	orderDWCOnly = "dwc-only" // Darwin Core terms only, in the official order
+)
+
+// Header cases for CSV output
+const (
+	caseKeep  = "keep"
+	caseLower = "lower"
+	caseUpper = "upper"
+)
+
+// outputDialect describes how to write the output, so that the same
+// data gives the same bytes whatever platform converts it. The zero
+// value keeps the input's columns in order and writes CSV comma-separated
+// with LF line endings, minimal quoting, no byte order mark and the
+// header as it is.
+type outputDialect struct {
+	delimiter  rune   // field separator, or 0 for comma
+	crlf       bool   // end lines with CRLF rather than LF
+	quoting    string // quoteMinimal or quoteAll
+	bom        bool   // start the file with a UTF-8 byte order mark
+	headerCase string // caseKeep, caseLower or caseUpper
+	order      string // orderInput, orderDWC or orderDWCOnly
+	pack       string // key scheme for packing columns into dynamicProperties, see packColumns
+}
+
+// comma returns the field separator of the output
+func (o outputDialect) comma() rune {
+	if o.delimiter == 0 {
+		return ','
+	}
+	return o.delimiter
+}
+
+// header returns the column names as the output writes them
+func (o outputDialect) header(terms []string) []string {
+	out := make([]string, len(terms))
+	for i, term := range terms {
+		switch o.headerCase {
+		case caseLower:
+			out[i] = strings.ToLower(term)
+		case caseUpper:
+			out[i] = strings.ToUpper(term)
+		default:
+			out[i] = term
+		}
+	}
+	return out
+}
+
+// csvWriter writes CSV in an outputDialect. Unlike a csv.Writer it
+// can quote every field.
+type csvWriter struct {
+	w   *bufio.Writer
+	out outputDialect
+}
+
+// newCSVWriter returns a CSV writer for output data
+func newCSVWriter(f io.Writer, out outputDialect) *csvWriter {
+	return &csvWriter{w: bufio.NewWriter(f), out: out}
+}
+
+func (cw *csvWriter) Write(record []string) error {
+	comma := cw.out.comma()
+	for i, field := range record {
+		if i > 0 {
+			cw.w.WriteRune(comma)
+		}
+		if !cw.needsQuotes(field) {
+			cw.w.WriteString(field)
+			continue
+		}
+		cw.w.WriteByte('"')
+		cw.w.WriteString(strings.ReplaceAll(field, `"`, `""`))
+		cw.w.WriteByte('"')
+	}
+	if cw.out.crlf {
+		cw.w.WriteString("\r\n")
+	} else {
+		cw.w.WriteByte('\n')
+	}
+	// bufio.Writer remembers the first error, which Flush returns
+	return nil
+}
+
+// needsQuotes returns true if field has to be quoted, following the
+// same rules as encoding/csv unless every field is quoted
+func (cw *csvWriter) needsQuotes(field string) bool {
+	if cw.out.quoting == quoteAll {
+		return true
+	}
+	if field == "" {
+		return false
+	}
+	if field == `\.` || strings.ContainsRune(field, cw.out.comma()) || strings.ContainsAny(field, "\"\r\n") {
+		return true
+	}
+	return field[0] == ' ' || field[0] == '\t'
+}
+
+// Flush writes any buffered data to the underlying io.Writer
+func (cw *csvWriter) Flush() error {
+	return cw.w.Flush()
+}
+
+// set checks the value of one output option, named as on the command
+// line, and sets it in o
+func (o *outputDialect) set(name, value string) error {
+	var err error
+	switch name {
+	case "output-delimiter":
+		o.delimiter, err = parseDelimiter(value)
+	case "line-ending":
+		switch strings.ToLower(value) {
+		case "lf":
+			o.crlf = false
+		case "crlf":
+			o.crlf = true
+		default:
+			err = fmt.Errorf("'%s' is not a line ending (use lf or crlf)", value)
+		}
+	case "quoting":
+		if !Include([]string{quoteMinimal, quoteAll}, value) {
+			err = fmt.Errorf("'%s' is not a quoting policy (use %v or %v)", value, quoteMinimal, quoteAll)
+			break
+		}
+		o.quoting = value
+	case "bom":
+		switch strings.ToLower(value) {
+		case "true", "yes":
+			o.bom = true
+		case "false", "no":
+			o.bom = false
+		default:
+			err = fmt.Errorf("'%s' is not true or false", value)
+		}
+	case "header-case":
+		if !Include([]string{caseKeep, caseLower, caseUpper}, value) {
+			err = fmt.Errorf("'%s' is not a header case (use %v, %v or %v)", value, caseKeep, caseLower, caseUpper)
+			break
+		}
+		o.headerCase = value
+	case "order":
+		if !Include([]string{orderInput, orderDWC, orderDWCOnly}, value) {
+			err = fmt.Errorf("'%s' is not a column order (use %v, %v or %v)", value, orderInput, orderDWC, orderDWCOnly)
+			break
+		}
+		o.order = value
+	case "dynamic-properties":
+		if !Include([]string{packOff, packKeep, packCamel, packSnake}, value) {
+			err = fmt.Errorf("'%s' is not a key scheme (use %v, %v, %v or %v)", value, packOff, packKeep, packCamel, packSnake)
+			break
+		}
+		o.pack = value
+	}
+	return err
+}
+
+// outputOptions are the names of the output options, which are the
+// same on the command line and in the settings file
+var outputOptions = []string{"output-delimiter", "line-ending", "quoting", "bom", "header-case", "order", "dynamic-properties"}
+
+// orderColumns puts the output columns, given with the input field of
+// each as returned by plan, in the official order of the Darwin Core
+// terms dwc. That order groups the terms by class: record-level terms
+// first, then Occurrence, Organism, MaterialSample, Event, Location,
+// GeologicalContext, Identification and Taxon. Other columns keep
+// their order after the terms, or are left out for orderDWCOnly.
+func orderColumns(terms []string, index []int, order string, dwc []string) ([]string, []int) {
+	if order != orderDWC && order != orderDWCOnly {
+		return terms, index
+	}
+	rank := func(term string) int {
+		if i := Index(dwc, term); i >= 0 {
+			return i
+		}
+		return len(dwc)
+	}
+
+	columns := make([]int, 0, len(terms))
+	var dropped []string
+	for i, term := range terms {
+		if order == orderDWCOnly && rank(term) == len(dwc) {
+			dropped = append(dropped, term)
+			continue
+		}
+		columns = append(columns, i)
+	}
+	sort.SliceStable(columns, func(a, b int) bool {
+		return rank(terms[columns[a]]) < rank(terms[columns[b]])
+	})
+	if len(dropped) > 0 {
+		fmt.Println("These columns aren't Darwin Core terms, so they are left out:")
+		printStringSlice(dropped)
+		fmt.Println()
+	}
+
+	orderedTerms := make([]string, len(columns))
+	orderedIndex := make([]int, len(columns))
+	for i, c := range columns {
+		orderedTerms[i], orderedIndex[i] = terms[c], index[c]
+	}
+	return orderedTerms, orderedIndex
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestCSVWriter(t *testing.T) {
+	var writeTests = []struct {
+		out    outputDialect
+		record []string
+		want   string
+	}{
+		{outputDialect{}, []string{"a", "b c", "", "d,e", `f"g`}, "a,b c,,\"d,e\",\"f\"\"g\"\n"},
+		{outputDialect{}, []string{" a", "b\nc"}, "\" a\",\"b\nc\"\n"},
+		{outputDialect{delimiter: '\t'}, []string{"a,b", "c\td"}, "a,b\t\"c\td\"\n"},
+		{outputDialect{quoting: quoteAll, crlf: true}, []string{"a", ""}, "\"a\",\"\"\r\n"},
+	}
+
+	for _, tt := range writeTests {
+		var b bytes.Buffer
+		w := newCSVWriter(&b, tt.out)
+		w.Write(tt.record)
+		w.Flush()
+		if b.String() != tt.want {
+			t.Errorf("Write(%q) with %+v: expected %q, got %q", tt.record, tt.out, tt.want, b.String())
+		}
+	}
+}
+
+func TestOrderColumns(t *testing.T) {
+	dwc := []string{"type", "occurrenceID", "catalogNumber", "eventDate", "decimalLatitude", "scientificName"}
+	terms := []string{"Cutmarks", "scientificName", "catalogNumber", "Notch", "eventDate"}
+	index := []int{0, 1, 2, 3, 4}
+	var orderTests = []struct {
+		order string
+		terms []string
+		index []int
+	}{
+		{orderInput, terms, index},
+		{orderDWC, []string{"catalogNumber", "eventDate", "scientificName", "Cutmarks", "Notch"}, []int{2, 4, 1, 0, 3}},
+		{orderDWCOnly, []string{"catalogNumber", "eventDate", "scientificName"}, []int{2, 4, 1}},
+	}
+
+	for _, tt := range orderTests {
+		gotTerms, gotIndex := orderColumns(terms, index, tt.order, dwc)
+		result, _ := json.Marshal([]interface{}{gotTerms, gotIndex})
+		expected, _ := json.Marshal([]interface{}{tt.terms, tt.index})
+		if string(result) != string(expected) {
+			t.Errorf("orderColumns(%v): expected %v, got %v", tt.order, string(expected), string(result))
+		}
+	}
+}
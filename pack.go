@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// How the columns packed into dynamicProperties are named in the JSON
+const (
+	packOff   = "off"   // don't pack columns
+	packKeep  = "keep"  // the column name as it is: "Notch aspect1"
+	packCamel = "camel" // lower camel case, like Darwin Core: "notchAspect1"
+	packSnake = "snake" // lower case with underscores: "notch_aspect1"
+)
+
+// packKey returns the JSON key for a column name in the given scheme
+func packKey(name, scheme string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 || scheme == packKeep {
+		return name
+	}
+	for i, word := range words {
+		word = strings.ToLower(word)
+		if scheme == packCamel && i > 0 {
+			r := []rune(word)
+			word = string(unicode.ToUpper(r[0])) + string(r[1:])
+		}
+		words[i] = word
+	}
+	if scheme == packSnake {
+		return strings.Join(words, "_")
+	}
+	return strings.Join(words, "")
+}
+
+// packReader adds the JSON object of the packed columns to the end of
+// every record
+type packReader struct {
+	r        recordReader
+	fields   []int    // input fields to pack
+	keys     []string // JSON key of each
+	existing int      // input field of a dynamicProperties column, or -1
+	out      []string
+}
+
+func (pr *packReader) Read() ([]string, error) {
+	record, err := pr.r.Read()
+	if err != nil {
+		return record, err
+	}
+	pr.out = append(pr.out[:0], record...)
+	pr.out = append(pr.out, pr.pack(record))
+	return pr.out, nil
+}
+
+// pack writes the non-empty packed fields of record as a JSON object,
+// after those of any existing dynamicProperties object
+func (pr *packReader) pack(record []string) string {
+	var members []string
+	if pr.existing >= 0 {
+		if value := strings.TrimSpace(record[pr.existing]); value != "" {
+			var object map[string]json.RawMessage
+			if strings.HasPrefix(value, "{") && json.Unmarshal([]byte(value), &object) == nil {
+				// keep the existing members as they are
+				if inner := strings.TrimSpace(value[1 : len(value)-1]); inner != "" {
+					members = append(members, inner)
+				}
+			} else {
+				members = append(members, jsonString("dynamicProperties")+":"+jsonString(value))
+			}
+		}
+	}
+	for i, field := range pr.fields {
+		if value := record[field]; strings.TrimSpace(value) != "" {
+			members = append(members, jsonString(pr.keys[i])+":"+jsonString(value))
+		}
+	}
+	if len(members) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(members, ",") + "}"
+}
+
+// packColumns takes the output columns that aren't Darwin Core terms
+// out of terms and index (as returned by plan) and packs them into a
+// dynamicProperties column instead, named in the given scheme. header
+// is the input header; the packed column is a field added to the end
+// of each record of the returned reader. A column already mapped to
+// dynamicProperties keeps its place, with the packed columns added to
+// its object. packed lists the input columns that go into the packed
+// column, including that one.
+func packColumns(header, terms []string, index []int, r recordReader, scheme string, dwc []string) ([]string, []int, recordReader, []string) {
+	pr := &packReader{r: r, existing: -1}
+	var packedTerms, packed []string
+	var packedIndex []int
+	place := -1
+	used := make(map[string]bool)
+	for i, term := range terms {
+		switch {
+		case term == "dynamicProperties" && place < 0:
+			pr.existing, place = index[i], len(packedTerms)
+			packedTerms = append(packedTerms, term)
+			packedIndex = append(packedIndex, len(header))
+		case termIRI(term, dwc) != "":
+			packedTerms = append(packedTerms, term)
+			packedIndex = append(packedIndex, index[i])
+		default:
+			key := packKey(term, scheme)
+			for n := 2; used[key]; n++ {
+				key = packKey(term, scheme) + strconv.Itoa(n)
+			}
+			used[key] = true
+			pr.fields = append(pr.fields, index[i])
+			pr.keys = append(pr.keys, key)
+			packed = append(packed, header[index[i]])
+		}
+	}
+	if len(pr.fields) == 0 {
+		return terms, index, r, nil
+	}
+	if pr.existing >= 0 {
+		packed = append([]string{header[pr.existing]}, packed...)
+	}
+	if place < 0 {
+		packedTerms = append(packedTerms, "dynamicProperties")
+		packedIndex = append(packedIndex, len(header))
+	}
+	fmt.Printf("Packing %v columns that aren't Darwin Core terms into dynamicProperties\n", len(pr.fields))
+	return packedTerms, packedIndex, pr, packed
+}
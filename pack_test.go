@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPackKey(t *testing.T) {
+	var keyTests = []struct {
+		name, scheme, key string
+	}{
+		{"Notch aspect1", packKeep, "Notch aspect1"},
+		{"Notch aspect1", packCamel, "notchAspect1"},
+		{"Notch aspect1", packSnake, "notch_aspect1"},
+		{"Fracture outline 1", packCamel, "fractureOutline1"},
+		{"Fracture outline 1", packSnake, "fracture_outline_1"},
+		{"BONE-TYPE (field)", packCamel, "boneTypeField"},
+		{"Cutmarks", packSnake, "cutmarks"},
+		{"--", packCamel, "--"},
+	}
+
+	for _, tt := range keyTests {
+		if key := packKey(tt.name, tt.scheme); key != tt.key {
+			t.Errorf("packKey(%q, %v): expected %q, got %q", tt.name, tt.scheme, tt.key, key)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultPartitionTemplate names each partition after the output file
+// and the value it holds: out.csv becomes out-Site1.csv, out-Site2.csv...
+const defaultPartitionTemplate = "{name}-{value}{ext}"
+
+// partitionName fills in a filename template for one partition of the
+// output file filename. {name} is the output file name without its
+// extension, {ext} the extension, {term} the partition term and {value}
+// the term's value, made safe for a file name.
+func partitionName(template, filename, term, value string) string {
+	ext := filepath.Ext(filename)
+	value = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(value))
+	if value == "" {
+		value = "none"
+	}
+	name := strings.NewReplacer(
+		"{name}", strings.TrimSuffix(filepath.Base(filename), ext),
+		"{ext}", ext,
+		"{term}", term,
+		"{value}", value,
+	).Replace(template)
+	return filepath.Join(filepath.Dir(filename), name)
+}
+
+// maxOpenSpools is how many partitions exportPartitions keeps open at
+// once. The others are closed until they get another record, so that
+// a term with thousands of values doesn't run out of file handles.
+const maxOpenSpools = 64
+
+// partition is the records of the input with one value of the
+// partition term, spooled to a temporary file
+type partition struct {
+	value string
+	path  string
+	file  *os.File // nil while the spool is closed
+	w     *bufio.Writer
+	n     int
+	last  int // the record written last, to close the least recently used spool
+}
+
+// closeSpool flushes the partition's spool and closes it
+func (p *partition) closeSpool() error {
+	err := p.w.Flush()
+	if closeErr := p.file.Close(); err == nil {
+		err = closeErr
+	}
+	p.file, p.w = nil, nil
+	return err
+}
+
+// writeSpooled writes a record to a spool as its number of fields
+// followed by each field's length and bytes, so that the fields come
+// back exactly as they were read, line breaks and all
+func writeSpooled(w *bufio.Writer, record []string) {
+	var n [binary.MaxVarintLen64]byte
+	w.Write(n[:binary.PutUvarint(n[:], uint64(len(record)))])
+	for _, field := range record {
+		w.Write(n[:binary.PutUvarint(n[:], uint64(len(field)))])
+		w.WriteString(field)
+	}
+}
+
+// spoolReader reads the records written by writeSpooled
+type spoolReader struct {
+	r *bufio.Reader
+}
+
+func (s spoolReader) Read() ([]string, error) {
+	count, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		// io.EOF only if the spool ends between records
+		return nil, err
+	}
+	record := make([]string, count)
+	for i := range record {
+		size, err := binary.ReadUvarint(s.r)
+		if err == nil {
+			field := make([]byte, size)
+			_, err = io.ReadFull(s.r, field)
+			record[i] = string(field)
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// exportPartitions writes one output file per value of term, named
+// with template (see partitionName), as exportDB would write it. It
+// also writes a manifest listing each file with its number of records.
+//
+// The records are sorted into temporary files first, so that each
+// output file can be written in any format in one go.
+func exportPartitions(filename, format, term, template string, header []string, r recordReader, s settings, dwc []string) {
+	terms, index := s.plan(header)
+	i := Index(terms, term)
+	if i < 0 {
+		fmt.Printf("Cannot split the output by \"%v\": there is no such column\n", term)
+		os.Exit(1)
+	}
+	field := index[i]
+
+	// the spools share a temporary folder, removed even if a later
+	// step gives up, see exit
+	dir, err := ioutil.TempDir("", "DWCHelper-")
+	if err != nil {
+		fmt.Println("Cannot create a temporary folder:", err.Error())
+		os.Exit(1)
+	}
+	temporary[dir] = true
+	defer func() {
+		os.RemoveAll(dir)
+		delete(temporary, dir)
+	}()
+
+	parts := make(map[string]*partition)
+	var order, open []*partition
+	for n := 0; ; n++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Println("Cannot read CSV data:", err.Error())
+			exit(1)
+		}
+		value := strings.TrimSpace(record[field])
+		p, ok := parts[value]
+		if !ok {
+			p = &partition{value: value, path: filepath.Join(dir, strconv.Itoa(len(order))+".csv")}
+			parts[value] = p
+			order = append(order, p)
+		}
+		if p.file == nil {
+			if len(open) == maxOpenSpools {
+				lru := 0
+				for j, q := range open {
+					if q.last < open[lru].last {
+						lru = j
+					}
+				}
+				if err := open[lru].closeSpool(); err != nil {
+					fmt.Println("Cannot write a temporary file:", err.Error())
+					exit(1)
+				}
+				open = append(open[:lru], open[lru+1:]...)
+			}
+			if p.file, err = os.OpenFile(p.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err != nil {
+				fmt.Println("Cannot create a temporary file:", err.Error())
+				exit(1)
+			}
+			p.w = bufio.NewWriter(p.file)
+			open = append(open, p)
+		}
+		writeSpooled(p.w, record)
+		p.n++
+		p.last = n
+	}
+	for _, p := range open {
+		if err := p.closeSpool(); err != nil {
+			fmt.Println("Cannot write a temporary file:", err.Error())
+			exit(1)
+		}
+	}
+
+	// write each partition, and the manifest
+	manifest := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".manifest.csv"
+	f, w := createCSV(manifest, s.output)
+	w.Write([]string{"file", term, "records"})
+	taken := make(map[string]bool)
+	for _, p := range order {
+		file, err := os.Open(p.path)
+		if err != nil {
+			fmt.Println("Cannot read a temporary file:", err.Error())
+			exit(1)
+		}
+		// values that differ only in characters a file name can't hold
+		// would share a file
+		name := partitionName(template, filename, term, p.value)
+		for n := 2; taken[name]; n++ {
+			name = partitionName(template, filename, term, p.value+" ("+strconv.Itoa(n)+")")
+		}
+		taken[name] = true
+
+		// the template may put the files in folders
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			fmt.Printf("Cannot create the folder for '%s': %s\n", name, err.Error())
+			exit(1)
+		}
+		exportDB(name, format, header, spoolReader{bufio.NewReader(file)}, s, dwc)
+		file.Close()
+		listed, err := filepath.Rel(filepath.Dir(filename), name)
+		if err != nil {
+			listed = name
+		}
+		w.Write([]string{filepath.ToSlash(listed), p.value, strconv.Itoa(p.n)})
+	}
+	finishCSV(manifest, w)
+	mustClose(f)
+	fmt.Printf("Split the output into %v files, listed in %v\n", len(order), manifest)
+}
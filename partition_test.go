@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartitionName(t *testing.T) {
+	var nameTests = []struct {
+		template, filename, value string
+		name                      string
+	}{
+		{defaultPartitionTemplate, "out.csv", "FLK", "out-FLK.csv"},
+		{defaultPartitionTemplate, "data/out.csv", "HWK/E", "data/out-HWK_E.csv"},
+		{defaultPartitionTemplate, "out.csv", " ", "out-none.csv"},
+		{"{term}_{value}.zip", "out.csv", "2019", "year_2019.zip"},
+		{"{value}/{name}{ext}", "out.ttl", "FLK", "FLK/out.ttl"},
+	}
+
+	for _, tt := range nameTests {
+		if name := partitionName(tt.template, tt.filename, "year", tt.value); name != filepath.FromSlash(tt.name) {
+			t.Errorf("partitionName(%q, %q, %q): expected %v, got %v", tt.template, tt.filename, tt.value, tt.name, name)
+		}
+	}
+}
+
+func TestExportPartitions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "DWCHelper-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a workbook cell may hold a Windows line break, which the split
+	// files must keep just as the whole output does
+	header := []string{"ID", "Site", "Notes"}
+	rows := map[string][][]string{
+		"FLK": {{"1", "FLK", "two\r\nlines"}, {"3", "FLK", "a\rb"}},
+		"HWK": {{"2", "HWK", " leading space"}, {"4", "HWK", `say "hi"`}},
+	}
+	all := [][]string{rows["FLK"][0], rows["HWK"][0], rows["FLK"][1], rows["HWK"][1]}
+	exportPartitions(filepath.Join(dir, "out.csv"), "", "Site", "{value}/{name}{ext}", header, &rowsReader{all}, settings{}, nil)
+
+	for _, value := range []string{"FLK", "HWK"} {
+		// each split file is the whole output of that value's records
+		whole := filepath.Join(dir, value+".csv")
+		exportDB(whole, "", header, &rowsReader{rows[value]}, settings{}, nil)
+		want, _ := ioutil.ReadFile(whole)
+		got, err := ioutil.ReadFile(filepath.Join(dir, value, "out.csv"))
+		if err != nil || string(got) != string(want) {
+			t.Errorf("%v: expected %q, got %q (%v)", value, want, got, err)
+		}
+	}
+
+	manifest, _ := ioutil.ReadFile(filepath.Join(dir, "out.manifest.csv"))
+	if want := "file,Site,records\nFLK/out.csv,FLK,2\nHWK/out.csv,HWK,2\n"; string(manifest) != want {
+		t.Errorf("manifest: expected %q, got %q", want, manifest)
+	}
+}
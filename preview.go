@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// maxDistinct is how many different values of a column the preview
+// counts before giving up
+const maxDistinct = 1000
+
+// previewWidth is how much of each value the preview shows
+const previewWidth = 24
+
+// columnStats sums up the values of one output column
+type columnStats struct {
+	filled   int
+	distinct map[string]bool
+	kind     string // see widenType
+	longest  int
+	example  string
+}
+
+// add counts one value of the column
+func (c *columnStats) add(value string) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	c.filled++
+	if len(c.distinct) < maxDistinct {
+		c.distinct[value] = true
+	}
+	c.kind = widenType(c.kind, value)
+	if n := len([]rune(value)); n > c.longest {
+		c.longest = n
+	}
+	if c.example == "" {
+		c.example = value
+	}
+}
+
+// clip shortens a value for the preview, on one line
+func clip(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if r := []rune(value); len(r) > previewWidth {
+		return string(r[:previewWidth-3]) + "..."
+	}
+	return value
+}
+
+// preview shows what converting the records in r would do without
+// writing anything: the removals and renames in s, the resulting
+// header, the first rows converted and a summary of every output
+// column. header is the input's header and dwc the list of Darwin Core
+// terms.
+func preview(header []string, r recordReader, s settings, rows int, dwc []string) {
+	PrintHLine(1)
+	if len(s.remove) > 0 {
+		fmt.Println("Columns removed:")
+		for _, term := range s.remove {
+			note := ""
+			if !Include(header, term) {
+				note = " (not in the input)"
+			}
+			fmt.Printf("  %v%v\n", term, note)
+		}
+	}
+	var renames []string
+	for _, row := range s.rename {
+		if row[0] != row[1] {
+			renames = append(renames, fmt.Sprintf("  %v -> %v", row[0], row[1]))
+		}
+	}
+	if len(renames) > 0 {
+		fmt.Println("Columns renamed:")
+		fmt.Println(strings.Join(renames, "\n"))
+	}
+
+	terms, index, r, _ := s.columns(header, r, dwc)
+	fmt.Printf("Output header (%v columns):\n", len(terms))
+	fmt.Println("  " + strings.Join(s.output.header(terms), ", "))
+	PrintHLine(1)
+
+	// read everything for the summary, keeping the first rows
+	stats := make([]columnStats, len(terms))
+	for i := range stats {
+		stats[i].distinct = make(map[string]bool)
+	}
+	var first [][]string
+	n := 0
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Println("Cannot read CSV data:", err.Error())
+			os.Exit(1)
+		}
+		out := make([]string, len(index))
+		for i, j := range index {
+			out[i] = strings.ToValidUTF8(record[j], "\uFFFD")
+			stats[i].add(out[i])
+		}
+		if len(first) < rows {
+			first = append(first, out)
+		}
+		n++
+	}
+
+	// the first rows, one column per row so that wide tables fit
+	if len(first) > 0 {
+		fmt.Printf("The first %v of %v rows would be:\n", len(first), n)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for i, term := range terms {
+			fmt.Fprint(tw, "  "+term)
+			for _, out := range first {
+				fmt.Fprint(tw, "\t"+clip(out[i]))
+			}
+			fmt.Fprintln(tw)
+		}
+		tw.Flush()
+		PrintHLine(1)
+	}
+
+	fmt.Printf("Column summary (%v rows):\n", n)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  column\tfilled\tdistinct\ttype\tlongest\texample")
+	for i, term := range terms {
+		c := stats[i]
+		distinct := strconv.Itoa(len(c.distinct))
+		if len(c.distinct) == maxDistinct {
+			distinct += "+"
+		}
+		kind := strings.ToLower(c.kind)
+		if kind == "" {
+			kind = "empty"
+		}
+		fmt.Fprintf(tw, "  %v\t%v\t%v\t%v\t%v\t%v\n", term, c.filled, distinct, kind, c.longest, clip(c.example))
+	}
+	tw.Flush()
+	PrintHLine(1)
+	fmt.Println("Dry run: nothing was written")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestColumnStats(t *testing.T) {
+	var statsTests = []struct {
+		values  []string
+		filled  int
+		kind    string
+		longest int
+		example string
+	}{
+		{[]string{"", " ", ""}, 0, typeNone, 0, ""},
+		{[]string{"3", "", "12"}, 2, typeInteger, 2, "3"},
+		{[]string{"3", "1.5"}, 2, typeReal, 3, "3"},
+		{[]string{"007", "12"}, 2, typeText, 3, "007"},
+		{[]string{"Ngorongoro"}, 1, typeText, 10, "Ngorongoro"},
+	}
+
+	for _, tt := range statsTests {
+		c := columnStats{distinct: make(map[string]bool)}
+		for _, v := range tt.values {
+			c.add(v)
+		}
+		if c.filled != tt.filled || c.kind != tt.kind || c.longest != tt.longest || c.example != tt.example {
+			t.Errorf("columnStats of %q: expected %v %v %v %q, got %v %v %v %q", tt.values,
+				tt.filled, tt.kind, tt.longest, tt.example, c.filled, c.kind, c.longest, c.example)
+		}
+	}
+}
+
+// capture returns what f prints
+func capture(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		done <- string(b)
+	}()
+	f()
+	w.Close()
+	os.Stdout = stdout
+	return <-done
+}
+
+func TestPreview(t *testing.T) {
+	header := []string{"ID", "Site", "Notes"}
+	rows := [][]string{{"1", "FLK", "x"}, {"2", "HWK", "x"}, {"3", "FLK", ""}}
+	s := settings{remove: []string{"Notes", "Weight"}, rename: [][]string{{"ID", "occurrenceID"}}}
+
+	out := capture(t, func() {
+		preview(header, &rowsReader{rows}, s, 2, []string{"occurrenceID"})
+	})
+	for _, want := range []string{
+		"Columns removed:\n  Notes\n  Weight (not in the input)\n",
+		"Columns renamed:\n  ID -> occurrenceID\n",
+		"Output header (2 columns):\n  occurrenceID, Site\n",
+		"The first 2 of 3 rows would be:\n",
+		"Column summary (3 rows):\n",
+		"Dry run: nothing was written\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("preview: expected %q in\n%v", want, out)
+		}
+	}
+
+	// the rows come one column per line, and the summary one line per
+	// column
+	var lines [][]string
+	for _, line := range strings.Split(out, "\n") {
+		lines = append(lines, strings.Fields(line))
+	}
+	for _, want := range [][]string{
+		{"occurrenceID", "1", "2"},
+		{"Site", "FLK", "HWK"},
+		{"occurrenceID", "3", "3", "integer", "1", "1"},
+		{"Site", "3", "2", "text", "3", "FLK"},
+	} {
+		found := false
+		for _, fields := range lines {
+			if strings.Join(fields, " ") == strings.Join(want, " ") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("preview: expected a line %v in\n%v", want, out)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// projectProfiles is the folder, under the current directory, for
+// profiles shared by everyone working on a project. It is only used
+// if it exists.
+var projectProfiles = filepath.Join(".dwchelper", "profiles")
+
+// A profile is a settings file with a name, kept apart from any input
+// file so that it can be applied to every export of the same database.
+// It holds what to remove and rename, how to write the output and the
+// columns of the last export; how to read each export stays in that
+// export's own settings file.
+// profileExt is the extension of profile files.
+const profileExt = ".json"
+
+// profileDirs returns the folders that hold profiles, in the order
+// they are searched: the project folder, if there is one, then the
+// user's own folder
+func profileDirs() []string {
+	var dirs []string
+	if info, err := os.Stat(projectProfiles); err == nil && info.IsDir() {
+		dirs = append(dirs, projectProfiles)
+	}
+	if config, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(config, "DWCHelper", "profiles"))
+	}
+	return dirs
+}
+
+// checkProfileName makes sure a profile name can be used as a file name
+func checkProfileName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:*?"<>|`) {
+		return fmt.Errorf("'%s' can't be used as a profile name", name)
+	}
+	return nil
+}
+
+// profilePath returns the file of the named profile: the first one
+// found in profileDirs, or where a new one would be saved
+func profilePath(name string) string {
+	dirs := profileDirs()
+	if len(dirs) == 0 {
+		// no config folder; keep it with the project
+		return filepath.Join(projectProfiles, name+profileExt)
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name+profileExt)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dirs[0], name+profileExt)
+}
+
+// profileNames lists the profiles in every profile folder
+func profileNames() []string {
+	var names []string
+	for _, dir := range profileDirs() {
+		files, _ := ioutil.ReadDir(dir)
+		for _, f := range files {
+			name := strings.TrimSuffix(f.Name(), profileExt)
+			if !f.IsDir() && name != f.Name() && !Include(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// settingsPath returns the file that holds the settings of input: the
+// profile given with -profile, or else <input>.settings
+func settingsPath(input string) string {
+	if *profileFlag != "" {
+		return profilePath(*profileFlag)
+	}
+	return localSettingsPath(input)
+}
+
+// localSettingsPath returns <input>.settings, which holds how to read
+// input even when a profile holds the rest
+func localSettingsPath(input string) string {
+	return input + ".settings"
+}
+
+// profileFile is the settings file of a profile: s without how to
+// read the input, but with its columns
+func profileFile(s settings) settingsFile {
+	file := s.file()
+	file.Input = &inputSection{Columns: s.header}
+	return file
+}
+
+// saveInputSettings saves the settings of input in <input>.settings,
+// or with -profile, in the profile. <input>.settings then only says
+// how to read the input and which profile has the rest, unless it has
+// settings of its own from runs without the profile.
+func saveInputSettings(input string, s settings) {
+	s.dialect.joins = savedJoins(input, s.dialect.joins)
+	if *profileFlag == "" {
+		saveSettings(localSettingsPath(input), s)
+		return
+	}
+	writeSettings(profilePath(*profileFlag), profileFile(s), s.output.crlf)
+	local, found := loadSettings(localSettingsPath(input))
+	if !found || local.profile != "" {
+		local = settings{profile: *profileFlag}
+	}
+	local.dialect = s.dialect
+	writeSettings(localSettingsPath(input), local.file(), s.output.crlf)
+}
+
+// saveProfile saves s as the named profile, replacing it if it exists
+func saveProfile(name string, s settings) {
+	path := profilePath(name)
+	if writeSettings(path, profileFile(s), s.output.crlf) {
+		fmt.Printf("Saved the settings as the profile \"%v\" in %v\n", name, path)
+	}
+}
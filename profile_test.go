@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckProfileName(t *testing.T) {
+	var nameTests = []struct {
+		name string
+		ok   bool
+	}{
+		{"olduvai", true},
+		{"Olduvai 2019", true},
+		{"", false},
+		{"..", false},
+		{"sites/olduvai", false},
+		{`C:olduvai`, false},
+		{"what?", false},
+	}
+
+	for _, tt := range nameTests {
+		if err := checkProfileName(tt.name); (err == nil) != tt.ok {
+			t.Errorf("checkProfileName(%q): expected ok %v, got %v", tt.name, tt.ok, err)
+		}
+	}
+}
+
+// inTempDir runs f in a new folder, with the user's configuration
+// folder inside it
+func inTempDir(t *testing.T, f func(dir string)) {
+	dir, err := ioutil.TempDir("", "DWCHelper-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	// UserConfigDir looks at one of these, depending on the system
+	for _, name := range []string{"XDG_CONFIG_HOME", "HOME", "AppData"} {
+		value, ok := os.LookupEnv(name)
+		defer func(name string) {
+			if ok {
+				os.Setenv(name, value)
+			} else {
+				os.Unsetenv(name)
+			}
+		}(name)
+	}
+
+	os.Chdir(dir)
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	os.Setenv("HOME", dir)
+	os.Setenv("AppData", filepath.Join(dir, "config"))
+	f(dir)
+}
+
+func TestProfilePath(t *testing.T) {
+	inTempDir(t, func(dir string) {
+		config, _ := os.UserConfigDir()
+		user := filepath.Join(config, "DWCHelper", "profiles")
+		os.MkdirAll(user, 0755)
+		ioutil.WriteFile(filepath.Join(user, "olduvai.json"), []byte("{}"), 0644)
+		ioutil.WriteFile(filepath.Join(user, "koobi.json"), []byte("{}"), 0644)
+
+		// without a project folder, profiles are the user's
+		if path := profilePath("new"); path != filepath.Join(user, "new.json") {
+			t.Errorf("profilePath(new): got %v", path)
+		}
+
+		// the project folder comes first, for new profiles too
+		os.MkdirAll(projectProfiles, 0755)
+		ioutil.WriteFile(filepath.Join(projectProfiles, "olduvai.json"), []byte("{}"), 0644)
+		var pathTests = []struct {
+			name, path string
+		}{
+			{"olduvai", filepath.Join(projectProfiles, "olduvai.json")},
+			{"koobi", filepath.Join(user, "koobi.json")},
+			{"new", filepath.Join(projectProfiles, "new.json")},
+		}
+		for _, tt := range pathTests {
+			if path := profilePath(tt.name); path != tt.path {
+				t.Errorf("profilePath(%v): expected %v, got %v", tt.name, tt.path, path)
+			}
+		}
+
+		result, _ := json.Marshal(profileNames())
+		if string(result) != `["koobi","olduvai"]` {
+			t.Errorf("profileNames: expected [koobi olduvai], got %v", string(result))
+		}
+	})
+}
+
+func TestSaveInputSettings(t *testing.T) {
+	inTempDir(t, func(dir string) {
+		os.MkdirAll(projectProfiles, 0755)
+		*profileFlag = "olduvai"
+		defer func() { *profileFlag = "" }()
+
+		s := settings{
+			remove: []string{"Notes"},
+			rename: [][]string{{"ID", "occurrenceID"}},
+			header: []string{"ID", "Notes"},
+		}
+		s.dialect.delimiter = ';'
+		saveInputSettings("2019.csv", s)
+
+		// the profile has the columns but not the delimiter
+		profile, _ := loadSettings(profilePath("olduvai"))
+		result, _ := json.Marshal([]interface{}{profile.remove, profile.rename, profile.header})
+		if string(result) != `[["Notes"],[["ID","occurrenceID"]],["ID","Notes"]]` || profile.dialect.delimiter != 0 {
+			t.Errorf("profile: got %v with delimiter %q", string(result), profile.dialect.delimiter)
+		}
+
+		// the input's own settings say how to read it and where the
+		// rest is
+		local, _ := loadSettings("2019.csv.settings")
+		if local.profile != "olduvai" || local.dialect.delimiter != ';' || len(local.remove) > 0 || local.header != nil {
+			t.Errorf("2019.csv.settings: got %+v", local)
+		}
+
+		// settings an input already has of its own are kept
+		ioutil.WriteFile("2020.csv.settings", []byte(`{"version":1,"remove":["Weight"],"rename":[]}`), 0644)
+		saveInputSettings("2020.csv", s)
+		local, _ = loadSettings("2020.csv.settings")
+		if local.profile != "" || local.dialect.delimiter != ';' || len(local.remove) != 1 {
+			t.Errorf("2020.csv.settings: got %+v", local)
+		}
+	})
+}
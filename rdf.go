@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The linked data formats: each record becomes a dwc:Occurrence, with
+// a property for each non-empty field
+var rdfFormats = []string{"turtle", "ntriples", "jsonld"}
+
+// rdfPrefixes are the namespaces the output uses, in order. The local
+// namespace holds the columns that aren't Darwin Core terms.
+var rdfPrefixes = []struct {
+	prefix, iri string
+}{
+	{"dwc", dwcNamespace},
+	{"dcterms", dcNamespace},
+	{"local", ""},
+}
+
+// localNamespace returns the namespace for columns that aren't Darwin
+// Core terms: namespace if it is set, or else a placeholder named
+// after the output file
+func localNamespace(filename, namespace string) string {
+	if namespace != "" {
+		return namespace
+	}
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	return "http://example.org/" + url.PathEscape(base) + "/"
+}
+
+// prefixedName matches the names that can be written as prefix:name
+var prefixedName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// rdfWriter writes records as linked data. It has the same Write
+// method as a csv.Writer, so convert can stream records into it.
+type rdfWriter struct {
+	w          *bufio.Writer
+	format     string
+	ns         string   // local namespace
+	properties []string // IRI of each column
+	names      []string // each column as prefix:name, for Turtle and JSON-LD
+	id         int      // column holding occurrenceID, or -1
+	n          int      // records written
+}
+
+// newRDFWriter starts a linked data document with the given columns,
+// which are Darwin Core terms if they are in dwc
+func newRDFWriter(f io.Writer, format string, header []string, ns string, dwc []string) *rdfWriter {
+	rw := &rdfWriter{w: bufio.NewWriter(f), format: format, ns: ns, id: Index(header, "occurrenceID")}
+	for _, term := range header {
+		iri := termIRI(term, dwc)
+		if iri == "" {
+			iri = ns + url.PathEscape(term)
+		}
+		rw.properties = append(rw.properties, iri)
+		rw.names = append(rw.names, rw.compact(iri))
+	}
+
+	switch format {
+	case "turtle":
+		for _, p := range rdfPrefixes {
+			fmt.Fprintf(rw.w, "@prefix %v: <%v> .\n", p.prefix, rw.namespace(p.iri))
+		}
+		fmt.Fprintln(rw.w)
+	case "jsonld":
+		fmt.Fprint(rw.w, "{\n  \"@context\": {")
+		for i, p := range rdfPrefixes {
+			if i > 0 {
+				fmt.Fprint(rw.w, ", ")
+			}
+			fmt.Fprintf(rw.w, "%s: %s", jsonString(p.prefix), jsonString(rw.namespace(p.iri)))
+		}
+		fmt.Fprint(rw.w, "},\n  \"@graph\": [")
+	}
+	return rw
+}
+
+// namespace returns iri, or the local namespace for the blank entry of
+// rdfPrefixes
+func (rw *rdfWriter) namespace(iri string) string {
+	if iri == "" {
+		return rw.ns
+	}
+	return iri
+}
+
+// compact writes iri as prefix:name if it is in one of the namespaces,
+// or else as a full IRI in angle brackets
+func (rw *rdfWriter) compact(iri string) string {
+	for _, p := range rdfPrefixes {
+		ns := rw.namespace(p.iri)
+		if name := strings.TrimPrefix(iri, ns); name != iri && prefixedName.MatchString(name) {
+			return p.prefix + ":" + name
+		}
+	}
+	return "<" + iri + ">"
+}
+
+// escapeIRI percent-escapes the characters that can't appear in an
+// IRI in Turtle or N-Triples: control characters, spaces and
+// <>"{}|^`\
+func escapeIRI(iri string) string {
+	var b strings.Builder
+	for i := 0; i < len(iri); i++ {
+		if c := iri[i]; c <= ' ' || c == 0x7f || strings.IndexByte("<>\"{}|^`\\", c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// subject returns the IRI of a record: its occurrenceID if that is
+// already an IRI (escaped where it needs to be), or else one in the
+// local namespace made from the occurrenceID or the record number
+func (rw *rdfWriter) subject(record []string) string {
+	if rw.id >= 0 {
+		id := strings.TrimSpace(record[rw.id])
+		if u, err := url.Parse(id); err == nil && u.IsAbs() {
+			return escapeIRI(id)
+		}
+		if id != "" {
+			return rw.ns + "occurrence/" + url.PathEscape(id)
+		}
+	}
+	return rw.ns + "occurrence/" + strconv.Itoa(rw.n+1)
+}
+
+func (rw *rdfWriter) Write(record []string) error {
+	subject := rw.subject(record)
+	switch rw.format {
+	case "ntriples":
+		fmt.Fprintf(rw.w, "<%v> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <%v> .\n", subject, occurrenceType)
+		for i, value := range record {
+			if value != "" {
+				fmt.Fprintf(rw.w, "<%v> <%v> %v .\n", subject, rw.properties[i], rdfLiteral(value))
+			}
+		}
+	case "turtle":
+		fmt.Fprintf(rw.w, "<%v> a dwc:Occurrence", subject)
+		for i, value := range record {
+			if value != "" {
+				fmt.Fprintf(rw.w, " ;\n    %v %v", rw.names[i], rdfLiteral(value))
+			}
+		}
+		fmt.Fprint(rw.w, " .\n\n")
+	case "jsonld":
+		if rw.n > 0 {
+			fmt.Fprint(rw.w, ",")
+		}
+		fmt.Fprintf(rw.w, "\n    {\"@id\": %s, \"@type\": \"dwc:Occurrence\"", jsonString(subject))
+		for i, value := range record {
+			if value == "" {
+				continue
+			}
+			// JSON-LD has no angle brackets; a full IRI is a key as it is
+			name := strings.TrimSuffix(strings.TrimPrefix(rw.names[i], "<"), ">")
+			fmt.Fprintf(rw.w, ", %s: %s", jsonString(name), jsonString(value))
+		}
+		fmt.Fprint(rw.w, "}")
+	}
+	rw.n++
+	return nil
+}
+
+// finish ends the document and flushes it to the file
+func (rw *rdfWriter) finish(filename string) {
+	if rw.format == "jsonld" {
+		fmt.Fprint(rw.w, "\n  ]\n}\n")
+	}
+	if err := rw.w.Flush(); err != nil {
+		fmt.Printf("Cannot write '%s': %s\n", filename, err.Error())
+		exit(1)
+	}
+}
+
+// rdfLiteral quotes a value as a Turtle or N-Triples string
+func rdfLiteral(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s) + `"`
+}
+
+// jsonString quotes a value as a JSON string
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// writeRDF streams the records in r, keeping the fields named by index,
+// into a linked data file at filename. It returns the number of
+// records written. dwc is the list of Darwin Core terms.
+func writeRDF(filename, format string, header []string, r recordReader, index []int, namespace string, dwc []string) int {
+	f := mustCreate(filename)
+	ns := localNamespace(filename, namespace)
+	rw := newRDFWriter(f, format, header, ns, dwc)
+	var local []string
+	for i, term := range header {
+		if strings.HasPrefix(rw.properties[i], ns) {
+			local = append(local, term)
+		}
+	}
+	if len(local) > 0 {
+		fmt.Println("These columns aren't Darwin Core terms, so they go in the namespace", ns)
+		printStringSlice(local)
+		fmt.Println()
+	}
+
+	n := convert(r, rw, index)
+	rw.finish(filename)
+	mustClose(f)
+	return n
+}
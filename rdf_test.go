@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	rw := &rdfWriter{ns: "http://example.org/olduvai/"}
+	var compactTests = []struct {
+		iri  string
+		name string // expected prefix:name or <iri>
+	}{
+		{"http://rs.tdwg.org/dwc/terms/catalogNumber", "dwc:catalogNumber"},
+		{"http://purl.org/dc/terms/modified", "dcterms:modified"},
+		{"http://example.org/olduvai/Weight", "local:Weight"},
+		{"http://example.org/olduvai/Bone%20type", "<http://example.org/olduvai/Bone%20type>"},
+		{"http://example.org/other/Weight", "<http://example.org/other/Weight>"},
+	}
+
+	for _, tt := range compactTests {
+		if name := rw.compact(tt.iri); name != tt.name {
+			t.Errorf("compact(%q): expected %v, got %v", tt.iri, tt.name, name)
+		}
+	}
+}
+
+func TestSubject(t *testing.T) {
+	rw := &rdfWriter{ns: "http://example.org/olduvai/"}
+	var subjectTests = []struct {
+		id      string // occurrenceID
+		subject string
+	}{
+		{"https://example.org/o/2", "https://example.org/o/2"},
+		{"urn:catalog:FLK 1", "urn:catalog:FLK%201"},
+		{`urn:x:<a>"b"{c}|^` + "`" + `\d`, "urn:x:%3Ca%3E%22b%22%7Bc%7D%7C%5E%60%5Cd"},
+		{"FLK 1", "http://example.org/olduvai/occurrence/FLK%201"},
+		{"", "http://example.org/olduvai/occurrence/1"},
+	}
+
+	for _, tt := range subjectTests {
+		if subject := rw.subject([]string{tt.id}); subject != tt.subject {
+			t.Errorf("subject(%q): expected %v, got %v", tt.id, tt.subject, subject)
+		}
+	}
+}
+
+func TestRDFWrite(t *testing.T) {
+	dwc := []string{"occurrenceID", "scientificName"}
+	header := []string{"occurrenceID", "scientificName", "Bone type"}
+	records := [][]string{
+		{"FLK-1", "Homo \"habilis\"", ""},
+		{"https://example.org/o/2", "", "femur"},
+	}
+	var writeTests = []struct {
+		format string
+		want   string
+	}{
+		{"ntriples", `<http://example.org/olduvai/occurrence/FLK-1> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://rs.tdwg.org/dwc/terms/Occurrence> .
+<http://example.org/olduvai/occurrence/FLK-1> <http://rs.tdwg.org/dwc/terms/occurrenceID> "FLK-1" .
+<http://example.org/olduvai/occurrence/FLK-1> <http://rs.tdwg.org/dwc/terms/scientificName> "Homo \"habilis\"" .
+<https://example.org/o/2> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://rs.tdwg.org/dwc/terms/Occurrence> .
+<https://example.org/o/2> <http://rs.tdwg.org/dwc/terms/occurrenceID> "https://example.org/o/2" .
+<https://example.org/o/2> <http://example.org/olduvai/Bone%20type> "femur" .
+`},
+		{"turtle", `@prefix dwc: <http://rs.tdwg.org/dwc/terms/> .
+@prefix dcterms: <http://purl.org/dc/terms/> .
+@prefix local: <http://example.org/olduvai/> .
+
+<http://example.org/olduvai/occurrence/FLK-1> a dwc:Occurrence ;
+    dwc:occurrenceID "FLK-1" ;
+    dwc:scientificName "Homo \"habilis\"" .
+
+<https://example.org/o/2> a dwc:Occurrence ;
+    dwc:occurrenceID "https://example.org/o/2" ;
+    <http://example.org/olduvai/Bone%20type> "femur" .
+
+`},
+		{"jsonld", `{
+  "@context": {"dwc": "http://rs.tdwg.org/dwc/terms/", "dcterms": "http://purl.org/dc/terms/", "local": "http://example.org/olduvai/"},
+  "@graph": [
+    {"@id": "http://example.org/olduvai/occurrence/FLK-1", "@type": "dwc:Occurrence", "dwc:occurrenceID": "FLK-1", "dwc:scientificName": "Homo \"habilis\""},
+    {"@id": "https://example.org/o/2", "@type": "dwc:Occurrence", "dwc:occurrenceID": "https://example.org/o/2", "http://example.org/olduvai/Bone%20type": "femur"}
+  ]
+}
+`},
+	}
+
+	for _, tt := range writeTests {
+		var b bytes.Buffer
+		rw := newRDFWriter(&b, tt.format, header, "http://example.org/olduvai/", dwc)
+		for _, record := range records {
+			rw.Write(record)
+		}
+		rw.finish(tt.format)
+		if b.String() != tt.want {
+			t.Errorf("Write in %v: expected\n%v\ngot\n%v", tt.format, tt.want, b.String())
+		}
+	}
+}
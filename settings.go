@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// settings holds the conversion choices saved between runs
+type settings struct {
+	remove  []string      // terms to remove completely
+	rename  [][]string    // pairs of old and new names
+	dialect inputDialect  // how to parse the input file
+	output  outputDialect // how to write the output file
+	meta    metadata      // describes the dataset, for eml.xml
+
+	// header is the input's columns when the settings were last made
+	// or updated, so that later runs can tell which columns are new
+	header []string
+
+	// namespace for columns that aren't Darwin Core terms in linked
+	// data output, see localNamespace
+	namespace string
+
+	// legacy is true if the settings came from a file in the old CSV
+	// format, which saveSettings will upgrade
+	legacy bool
+
+	// profile names the profile that holds the rest of the settings of
+	// an input that is converted with one, see saveInputSettings
+	profile string
+}
+
+// settingsVersion is the version of the settings file format that
+// saveSettings writes. Files without a version are the legacy CSV
+// format.
+const settingsVersion = 1
+
+// schemaURL is where the JSON schema of the settings file is published
+const schemaURL = "https://git.sr.ht/~wrycode/DWCHelper/blob/master/settings.schema.json"
+
+// settingsFile is the settings file as it is saved, in JSON. It is
+// described by settings.schema.json; keep the two in step, and bump
+// settingsVersion for changes older versions can't read.
+type settingsFile struct {
+	Schema   string         `json:"$schema,omitempty"`
+	Version  int            `json:"version"`
+	Profile  string         `json:"profile,omitempty"`
+	Remove   []string       `json:"remove"`
+	Rename   []renameEntry  `json:"rename"`
+	Input    *inputSection  `json:"input,omitempty"`
+	Output   *outputSection `json:"output,omitempty"`
+	Metadata *metaSection   `json:"metadata,omitempty"`
+}
+
+type renameEntry struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type inputSection struct {
+	Columns    []string          `json:"columns,omitempty"`
+	Delimiter  string            `json:"delimiter,omitempty"`
+	Quote      string            `json:"quote,omitempty"`
+	Sheet      string            `json:"sheet,omitempty"`
+	HeaderRow  int               `json:"headerRow,omitempty"`
+	HeaderRows int               `json:"headerRows,omitempty"`
+	Duplicates map[string]string `json:"duplicates,omitempty"`
+	Joins      []joinEntry       `json:"joins,omitempty"`
+}
+
+type joinEntry struct {
+	File     string `json:"file"`
+	LeftKey  string `json:"leftKey"`
+	RightKey string `json:"rightKey"`
+}
+
+type outputSection struct {
+	Delimiter         string `json:"delimiter,omitempty"`
+	LineEnding        string `json:"lineEnding,omitempty"`
+	Quoting           string `json:"quoting,omitempty"`
+	BOM               bool   `json:"bom,omitempty"`
+	HeaderCase        string `json:"headerCase,omitempty"`
+	Order             string `json:"order,omitempty"`
+	DynamicProperties string `json:"dynamicProperties,omitempty"`
+	Namespace         string `json:"namespace,omitempty"`
+}
+
+type metaSection struct {
+	Title     string         `json:"title,omitempty"`
+	Abstract  string         `json:"abstract,omitempty"`
+	Creators  []creatorEntry `json:"creators,omitempty"`
+	License   string         `json:"license,omitempty"`
+	Geography string         `json:"geography,omitempty"`
+}
+
+type creatorEntry struct {
+	Name         string `json:"name"`
+	Organisation string `json:"organisation,omitempty"`
+	Email        string `json:"email,omitempty"`
+}
+
+// loadSettings reads the settings file at filename, in either format.
+// It returns false if the file can't be opened, which means there is
+// no previous run.
+func loadSettings(filename string) (settings, bool) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return settings{}, false
+	}
+	// the legacy format is CSV, which never starts with a brace
+	if !bytes.HasPrefix(bytes.TrimSpace(contents), []byte("{")) {
+		s := readLegacySettings(bytes.NewReader(contents))
+		s.legacy = true
+		return s, true
+	}
+
+	var file settingsFile
+	if err := json.Unmarshal(contents, &file); err != nil {
+		fmt.Printf("Cannot read the settings file '%s': %s\n", filename, err.Error())
+		os.Exit(1)
+	}
+	if file.Version > settingsVersion {
+		fmt.Printf("%v was saved by a newer DWCHelper (settings version %v); settings it doesn't know are ignored\n", filename, file.Version)
+	}
+	return file.settings(), true
+}
+
+// settings turns a settings file into settings, ignoring (with a
+// warning) any value that isn't valid
+func (file settingsFile) settings() settings {
+	s := settings{profile: file.Profile}
+	ignore := func(name string, err error) {
+		if err != nil {
+			fmt.Println("Ignoring", name, "in the settings file:", err.Error())
+		}
+	}
+
+	for _, term := range file.Remove {
+		if term != "" {
+			s.remove = append(s.remove, term)
+		}
+	}
+	for _, r := range file.Rename {
+		if r.From != "" && r.To != "" {
+			s.rename = append(s.rename, []string{r.From, r.To})
+		}
+	}
+
+	if in := file.Input; in != nil {
+		var err error
+		if in.Delimiter != "" {
+			s.dialect.delimiter, err = parseDelimiter(in.Delimiter)
+			ignore("input.delimiter", err)
+		}
+		if in.Quote != "" {
+			s.dialect.quote, err = parseQuote(in.Quote)
+			ignore("input.quote", err)
+		}
+		s.header = in.Columns
+		s.dialect.sheet = in.Sheet
+		if in.HeaderRow > 0 {
+			s.dialect.headerRow, s.dialect.headerRows = in.HeaderRow, 1
+			if in.HeaderRows > 0 {
+				s.dialect.headerRows = in.HeaderRows
+			}
+		}
+		for name, choice := range in.Duplicates {
+			if !Include([]string{dupSuffix, dupMerge, dupDrop}, choice) {
+				ignore("input.duplicates", fmt.Errorf("'%s' is not suffix, merge or drop", choice))
+				continue
+			}
+			if s.dialect.duplicates == nil {
+				s.dialect.duplicates = make(map[string]string)
+			}
+			s.dialect.duplicates[name] = choice
+		}
+		for _, j := range in.Joins {
+			s.dialect.joins = append(s.dialect.joins, join{file: j.File, leftKey: j.LeftKey, rightKey: j.RightKey})
+		}
+	}
+
+	if out := file.Output; out != nil {
+		for _, o := range []struct{ name, value string }{
+			{"output-delimiter", out.Delimiter},
+			{"line-ending", out.LineEnding},
+			{"quoting", out.Quoting},
+			{"header-case", out.HeaderCase},
+			{"order", out.Order},
+			{"dynamic-properties", out.DynamicProperties},
+		} {
+			if o.value != "" {
+				ignore("output."+o.name, s.output.set(o.name, o.value))
+			}
+		}
+		s.output.bom = out.BOM
+		s.namespace = out.Namespace
+	}
+
+	if m := file.Metadata; m != nil {
+		s.meta = metadata{title: m.Title, abstract: m.Abstract, license: m.License, geography: m.Geography}
+		for _, c := range m.Creators {
+			s.meta.creators = append(s.meta.creators, creator{name: c.Name, organisation: c.Organisation, email: c.Email})
+		}
+	}
+	return s
+}
+
+// file turns settings into the settings file that saves them
+func (s settings) file() settingsFile {
+	file := settingsFile{
+		Schema:  schemaURL,
+		Version: settingsVersion,
+		Profile: s.profile,
+		Remove:  append([]string{}, s.remove...),
+		Rename:  []renameEntry{},
+	}
+	for _, row := range s.rename {
+		file.Rename = append(file.Rename, renameEntry{row[0], row[1]})
+	}
+
+	in := inputSection{Columns: s.header, Sheet: s.dialect.sheet}
+	if s.dialect.delimiter != 0 {
+		in.Delimiter = delimiterName(s.dialect.delimiter)
+	}
+	if s.dialect.quote != 0 {
+		in.Quote = string(s.dialect.quote)
+	}
+	if s.dialect.headerRow > 1 {
+		in.HeaderRow, in.HeaderRows = s.dialect.headerRow, s.dialect.headerRows
+	}
+	if len(s.dialect.duplicates) > 0 {
+		in.Duplicates = s.dialect.duplicates
+	}
+	for _, j := range s.dialect.joins {
+		in.Joins = append(in.Joins, joinEntry{j.file, j.leftKey, j.rightKey})
+	}
+	file.Input = &in
+
+	o := s.output
+	out := outputSection{Quoting: o.quoting, BOM: o.bom, HeaderCase: o.headerCase, Order: o.order, DynamicProperties: o.pack, Namespace: s.namespace}
+	if o.delimiter != 0 {
+		out.Delimiter = delimiterName(o.delimiter)
+	}
+	if o.crlf {
+		out.LineEnding = "crlf"
+	}
+	if out != (outputSection{}) {
+		file.Output = &out
+	}
+
+	m := s.meta
+	if m.title != "" || m.abstract != "" || len(m.creators) > 0 || m.license != "" || m.geography != "" {
+		file.Metadata = &metaSection{Title: m.title, Abstract: m.abstract, License: m.license, Geography: m.geography}
+		for _, c := range m.creators {
+			file.Metadata.Creators = append(file.Metadata.Creators, creatorEntry{c.name, c.organisation, c.email})
+		}
+	}
+	return file
+}
+
+// saveSettings writes s to the settings file at filename, and reports
+// whether it could. Failing to save is not fatal; the conversion goes
+// ahead without it.
+func saveSettings(filename string, s settings) bool {
+	return writeSettings(filename, s.file(), s.output.crlf)
+}
+
+// writeSettings writes a settings file for saveSettings, with CRLF
+// line endings if crlf is true
+func writeSettings(filename string, file settingsFile, crlf bool) bool {
+	contents, err := json.MarshalIndent(file, "", "  ")
+	if err == nil {
+		// profiles may be the first in their folder
+		err = os.MkdirAll(filepath.Dir(filename), 0755)
+	}
+	if err == nil {
+		contents = append(contents, '\n')
+		// the same line endings as the output
+		if crlf {
+			contents = bytes.ReplaceAll(contents, []byte("\n"), []byte("\r\n"))
+		}
+		var f *atomicFile
+		if f, err = createFile(filename); err == nil {
+			_, err = f.Write(contents)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf("Cannot save settings to '%s': %s\n", filename, err.Error())
+		fmt.Println("Proceeding without saving your conversion settings...")
+		return false
+	}
+	return true
+}
+
+// diffColumns returns the columns of header that aren't in saved, and
+// those of saved that aren't in header
+func diffColumns(saved, header []string) (added, gone []string) {
+	for _, term := range header {
+		if !Include(saved, term) {
+			added = append(added, term)
+		}
+	}
+	for _, term := range saved {
+		if !Include(header, term) {
+			gone = append(gone, term)
+		}
+	}
+	return added, gone
+}
+
+// migrateSettings rewrites settings files in the legacy CSV format in
+// the current format, leaving files that are already current alone
+func migrateSettings(filenames []string) {
+	for _, filename := range filenames {
+		s, ok := loadSettings(filename)
+		switch {
+		case !ok:
+			fmt.Printf("Cannot open '%s'\n", filename)
+		case !s.legacy:
+			fmt.Printf("%v is already in the current format\n", filename)
+		default:
+			saveSettings(filename, s)
+			fmt.Printf("Upgraded %v to settings version %v\n", filename, settingsVersion)
+		}
+	}
+}
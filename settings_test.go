@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMigrateSettings(t *testing.T) {
+	var migrateTests = []struct {
+		legacy string
+		want   string
+	}{
+		{"Notes\nID,occurrenceID\n",
+			`{"version":1,"remove":["Notes"],"rename":[{"from":"ID","to":"occurrenceID"}],"input":{}}`},
+		{"\nID,occurrenceID\n@delimiter,semicolon\n@header,3,2\n@duplicate,Date,merge\n",
+			`{"version":1,"remove":[],"rename":[{"from":"ID","to":"occurrenceID"}],"input":{"delimiter":"semicolon","headerRow":3,"headerRows":2,"duplicates":{"Date":"merge"}}}`},
+		{"\n@line-ending,crlf\n@order,dwc\n@namespace,http://example.org/o/\n@title,Olduvai\n@creator,Ann,Uni,ann@example.org\n",
+			`{"version":1,"remove":[],"rename":[],"input":{},"output":{"lineEnding":"crlf","order":"dwc","namespace":"http://example.org/o/"},"metadata":{"title":"Olduvai","creators":[{"name":"Ann","organisation":"Uni","email":"ann@example.org"}]}}`},
+	}
+
+	for _, tt := range migrateTests {
+		file := readLegacySettings(strings.NewReader(tt.legacy)).file()
+		file.Schema = ""
+		result, _ := json.Marshal(file)
+		if string(result) != tt.want {
+			t.Errorf("migrating %q: expected %v, got %v", tt.legacy, tt.want, string(result))
+		}
+
+		// and reading the new file back gives the same settings
+		var reread settingsFile
+		json.Unmarshal(result, &reread)
+		again := reread.settings().file()
+		again.Schema = ""
+		if result2, _ := json.Marshal(again); string(result2) != string(result) {
+			t.Errorf("rereading %v: got %v", string(result), string(result2))
+		}
+	}
+}
+
+func TestDiffColumns(t *testing.T) {
+	var diffTests = []struct {
+		saved, header []string
+		added, gone   []string
+	}{
+		{[]string{"ID", "Site"}, []string{"ID", "Site"}, nil, nil},
+		{[]string{"ID", "Site"}, []string{"ID", "Lat", "Site", "Long"}, []string{"Lat", "Long"}, nil},
+		{[]string{"ID", "Site", "Notes"}, []string{"Site", "ID", "Remarks"}, []string{"Remarks"}, []string{"Notes"}},
+	}
+
+	for _, tt := range diffTests {
+		added, gone := diffColumns(tt.saved, tt.header)
+		result, _ := json.Marshal([][]string{added, gone})
+		expected, _ := json.Marshal([][]string{tt.added, tt.gone})
+		if string(result) != string(expected) {
+			t.Errorf("diffColumns(%v, %v): expected %v, got %v", tt.saved, tt.header, string(expected), string(result))
+		}
+	}
+}
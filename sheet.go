@@ -0,0 +1,648 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isWorkbook returns true if filename is an Excel or LibreOffice
+// spreadsheet rather than a text file
+func isWorkbook(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx", ".ods":
+		return true
+	}
+	return false
+}
+
+// sheetNames lists the sheets in a workbook, in order
+func sheetNames(filename string) ([]string, error) {
+	z, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	if strings.EqualFold(filepath.Ext(filename), ".ods") {
+		var names []string
+		err := readODS(&z.Reader, func(name string) bool {
+			names = append(names, name)
+			return false
+		}, nil)
+		return names, err
+	}
+
+	sheets, _, err := xlsxSheets(&z.Reader)
+	var names []string
+	for _, s := range sheets {
+		names = append(names, s.Name)
+	}
+	return names, err
+}
+
+// readSheet reads every row of the named sheet of a workbook. Cells
+// keep their type: numbers come through as Excel shows them, and
+// dates as ISO 8601 rather than Excel's day counts. Rows are padded
+// to the same length.
+func readSheet(filename, sheet string) ([][]string, error) {
+	z, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	var rows [][]string
+	if strings.EqualFold(filepath.Ext(filename), ".ods") {
+		found := false
+		err = readODS(&z.Reader, func(name string) bool {
+			found = found || name == sheet
+			return name == sheet
+		}, func(row []string) {
+			rows = append(rows, row)
+		})
+		if err == nil && !found {
+			err = fmt.Errorf("there is no sheet called '%s'", sheet)
+		}
+	} else {
+		rows, err = readXLSX(&z.Reader, sheet)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// spreadsheets leave out empty cells at the end of a row, and
+	// empty rows altogether
+	width := 0
+	var kept [][]string
+	for _, row := range rows {
+		for len(row) > 0 && row[len(row)-1] == "" {
+			row = row[:len(row)-1]
+		}
+		if len(row) > 0 {
+			kept = append(kept, row)
+		}
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	for i, row := range kept {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		kept[i] = row
+	}
+	return kept, nil
+}
+
+// rowsReader hands out rows that are already in memory, one at a time
+type rowsReader struct {
+	rows [][]string
+}
+
+func (r *rowsReader) Read() ([]string, error) {
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	return row, nil
+}
+
+// noClose is the io.Closer for inputs that are already in memory
+type noClose struct{}
+
+func (noClose) Close() error { return nil }
+
+// openZipFile opens the named member of a zip archive
+func openZipFile(z *zip.Reader, name string) (io.ReadCloser, error) {
+	for _, f := range z.File {
+		if f.Name == name {
+			return f.Open()
+		}
+	}
+	return nil, fmt.Errorf("%s is missing from the workbook", name)
+}
+
+// decodeZipFile unmarshals the named XML member of a zip archive into
+// v. Missing optional members leave v untouched.
+func decodeZipFile(z *zip.Reader, name string, v interface{}, optional bool) error {
+	f, err := openZipFile(z, name)
+	if err != nil {
+		if optional {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return xml.NewDecoder(f).Decode(v)
+}
+
+// xlsxSheet is a sheet listed in xl/workbook.xml
+type xlsxSheet struct {
+	Name string `xml:"name,attr"`
+	RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+}
+
+// xlsxSheets lists the sheets of an Excel workbook and whether its
+// dates count from 1904
+func xlsxSheets(z *zip.Reader) ([]xlsxSheet, bool, error) {
+	var wb struct {
+		Pr struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []xlsxSheet `xml:"sheets>sheet"`
+	}
+	err := decodeZipFile(z, "xl/workbook.xml", &wb, false)
+	date1904 := wb.Pr.Date1904 == "1" || wb.Pr.Date1904 == "true"
+	return wb.Sheets, date1904, err
+}
+
+// readXLSX reads the rows of the named sheet of an Excel workbook
+func readXLSX(z *zip.Reader, sheet string) ([][]string, error) {
+	sheets, date1904, err := xlsxSheets(z)
+	if err != nil {
+		return nil, err
+	}
+	var rid string
+	for _, s := range sheets {
+		if s.Name == sheet {
+			rid = s.RID
+		}
+	}
+	if rid == "" {
+		return nil, fmt.Errorf("there is no sheet called '%s'", sheet)
+	}
+
+	// find the sheet's file
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeZipFile(z, "xl/_rels/workbook.xml.rels", &rels, false); err != nil {
+		return nil, err
+	}
+	var sheetFile string
+	for _, rel := range rels.Relationships {
+		if rel.ID == rid {
+			sheetFile = rel.Target
+		}
+	}
+	if strings.HasPrefix(sheetFile, "/") {
+		sheetFile = strings.TrimPrefix(sheetFile, "/")
+	} else {
+		sheetFile = path.Join("xl", sheetFile)
+	}
+
+	strs, err := xlsxSharedStrings(z)
+	if err != nil {
+		return nil, err
+	}
+	dates, err := xlsxDateStyles(z)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := openZipFile(z, sheetFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows [][]string
+	var row []string
+	var cellType, cellRef, style, value, inline string
+	inValue, inInline := false, false
+	d := xml.NewDecoder(f)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row = nil
+			case "c":
+				cellType, cellRef, style = attr(t, "t"), attr(t, "r"), attr(t, "s")
+				value, inline = "", ""
+			case "v":
+				inValue = true
+			case "is":
+				inInline = true
+			}
+		case xml.CharData:
+			if inValue {
+				value += string(t)
+			} else if inInline {
+				inline += string(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v":
+				inValue = false
+			case "is":
+				inInline = false
+			case "c":
+				// skipped cells are empty
+				if col := columnIndex(cellRef); col >= 0 {
+					for len(row) < col {
+						row = append(row, "")
+					}
+				}
+				s, _ := strconv.Atoi(style)
+				row = append(row, xlsxValue(cellType, value, inline, strs, dates[s], date1904))
+			case "row":
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// attr returns the value of the named attribute of an element
+func attr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// columnIndex turns a cell reference like "AB12" into a zero-based
+// column number, or -1 if there is no reference
+func columnIndex(ref string) int {
+	col := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A') + 1
+	}
+	return col - 1
+}
+
+// xlsxValue formats one Excel cell according to its type
+func xlsxValue(cellType, value, inline string, strs []string, date, date1904 bool) string {
+	switch cellType {
+	case "s":
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 || i >= len(strs) {
+			return ""
+		}
+		return strs[i]
+	case "inlineStr":
+		return inline
+	case "b":
+		if value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "str", "e", "d":
+		return value
+	}
+
+	// a number, which may be a date
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	if date {
+		return serialDate(f, date1904)
+	}
+	return formatNumber(f)
+}
+
+// formatNumber writes a number to the 15 significant digits Excel
+// displays, so that 0.1+0.2 comes out as 0.3
+func formatNumber(f float64) string {
+	f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// serialDate converts an Excel date serial (days since the epoch, with
+// the time of day as a fraction) into ISO 8601
+func serialDate(f float64, date1904 bool) string {
+	// 1899-12-30 rather than 1900-01-01 makes up for Excel treating
+	// 1900 as a leap year
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	days := math.Floor(f)
+	seconds := math.Round((f - days) * 24 * 60 * 60)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+	switch {
+	case seconds == 0:
+		return t.Format("2006-01-02")
+	case days == 0:
+		return t.Format("15:04:05")
+	}
+	return t.Format("2006-01-02T15:04:05")
+}
+
+// xlsxSharedStrings reads the table of strings that text cells refer to
+func xlsxSharedStrings(z *zip.Reader) ([]string, error) {
+	f, err := openZipFile(z, "xl/sharedStrings.xml")
+	if err != nil {
+		// workbooks without text don't have one
+		return nil, nil
+	}
+	defer f.Close()
+
+	var strs []string
+	var b strings.Builder
+	inText, inPhonetic := false, false
+	d := xml.NewDecoder(f)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return strs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				b.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.CharData:
+			if inText && !inPhonetic {
+				b.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				strs = append(strs, b.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		}
+	}
+}
+
+// xlsxDateStyles reports, for each cell style in the workbook, whether
+// numbers in that style are dates
+func xlsxDateStyles(z *zip.Reader) (map[int]bool, error) {
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := decodeZipFile(z, "xl/styles.xml", &styles, true); err != nil {
+		return nil, err
+	}
+
+	custom := make(map[int]string)
+	for _, nf := range styles.NumFmts {
+		custom[nf.ID] = nf.Code
+	}
+	dates := make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		if code, ok := custom[xf.NumFmtID]; ok {
+			dates[i] = isDateFormat(code)
+		} else {
+			dates[i] = isDateFormatID(xf.NumFmtID)
+		}
+	}
+	return dates, nil
+}
+
+// isDateFormatID returns true for Excel's built-in date and time
+// number formats
+func isDateFormatID(id int) bool {
+	return (id >= 14 && id <= 22) || (id >= 27 && id <= 36) || (id >= 45 && id <= 47) || (id >= 50 && id <= 58)
+}
+
+// isDateFormat returns true if a custom number format code shows a
+// date or time, ignoring quoted text, escapes and [colour] sections
+func isDateFormat(code string) bool {
+	quoted, bracket, escaped := false, false, false
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			bracket = true
+		case c == ']':
+			bracket = false
+		case bracket:
+		case strings.ContainsRune("dmyhs", c):
+			return true
+		}
+	}
+	return false
+}
+
+// maxRepeat caps how many empty ODS rows or cells at the end of a
+// table or row are kept; LibreOffice pads sheets with enormous runs of
+// them. Runs of cells or rows with values are always expanded in full.
+const maxRepeat = 1000
+
+// readODS walks the tables of an OpenDocument spreadsheet. For each
+// table it calls want with the table's name; if want returns true
+// every row of that table is passed to rowFn.
+func readODS(z *zip.Reader, want func(string) bool, rowFn func([]string)) error {
+	f, err := openZipFile(z, "content.xml")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var row []string
+	var text strings.Builder
+	var cellValue string
+	var cellRepeat, rowRepeat int
+	reading, inCell, paragraphs := false, false, 0
+
+	// empty cells and rows wait until something follows them, so that
+	// those at the end can be capped
+	emptyCells := 0
+	var emptyRows []odsRun
+	flushRows := func(limit int) {
+		for _, run := range emptyRows {
+			for i := 0; i < run.n && limit != 0; i++ {
+				rowFn(run.row)
+				limit--
+			}
+		}
+		emptyRows = nil
+	}
+
+	d := xml.NewDecoder(f)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table":
+				reading = want(attr(t, "name"))
+			case "table-row":
+				row = nil
+				emptyCells = 0
+				rowRepeat = repeat(attr(t, "number-rows-repeated"))
+			case "table-cell", "covered-table-cell":
+				inCell = true
+				text.Reset()
+				paragraphs = 0
+				cellValue = odsValue(t)
+				cellRepeat = repeat(attr(t, "number-columns-repeated"))
+			case "annotation":
+				// a cell comment, not part of the value
+				if err := d.Skip(); err != nil {
+					return err
+				}
+			case "p":
+				if inCell && paragraphs > 0 {
+					text.WriteString("\n")
+				}
+				paragraphs++
+			case "s":
+				// runs of spaces
+				if inCell {
+					text.WriteString(strings.Repeat(" ", repeat(attr(t, "c"))))
+				}
+			case "tab":
+				if inCell {
+					text.WriteString("\t")
+				}
+			case "line-break":
+				if inCell {
+					text.WriteString("\n")
+				}
+			}
+		case xml.CharData:
+			if inCell && paragraphs > 0 {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "table-cell", "covered-table-cell":
+				inCell = false
+				value := cellValue
+				if value == "" {
+					value = text.String()
+				}
+				if value == "" {
+					emptyCells += cellRepeat
+					break
+				}
+				for ; emptyCells > 0; emptyCells-- {
+					row = append(row, "")
+				}
+				for i := 0; i < cellRepeat; i++ {
+					row = append(row, value)
+				}
+			case "table-row":
+				if !reading || rowFn == nil {
+					break
+				}
+				empty := len(row) == 0
+				if emptyCells > maxRepeat {
+					emptyCells = maxRepeat
+				}
+				for ; emptyCells > 0; emptyCells-- {
+					row = append(row, "")
+				}
+				if empty {
+					emptyRows = append(emptyRows, odsRun{row, rowRepeat})
+					break
+				}
+				flushRows(-1) // no limit
+				for i := 0; i < rowRepeat; i++ {
+					rowFn(row)
+				}
+			case "table":
+				if reading {
+					if rowFn != nil {
+						flushRows(maxRepeat)
+					}
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// odsRun is a row of an ODS table repeated n times
+type odsRun struct {
+	row []string
+	n   int
+}
+
+// repeat parses a repeat count attribute
+func repeat(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// odsValue returns the typed value of an ODS cell, or "" if the
+// displayed text should be used instead
+func odsValue(t xml.StartElement) string {
+	switch attr(t, "value-type") {
+	case "float", "percentage", "currency":
+		if f, err := strconv.ParseFloat(attr(t, "value"), 64); err == nil {
+			return formatNumber(f)
+		}
+	case "date":
+		return attr(t, "date-value")
+	case "time":
+		return odsTime(attr(t, "time-value"))
+	case "boolean":
+		if attr(t, "boolean-value") == "true" {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return ""
+}
+
+// odsTime converts an ISO 8601 duration like PT10H30M00S into 10:30:00
+func odsTime(s string) string {
+	var h, m int
+	var sec float64
+	if _, err := fmt.Sscanf(s, "PT%dH%dM%fS", &h, &m, &sec); err != nil {
+		return s
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", h, m, int(math.Round(sec)))
+}
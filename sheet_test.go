@@ -0,0 +1,124 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func TestSerialDate(t *testing.T) {
+	var serialTests = []struct {
+		serial   float64 // Excel date serial
+		date1904 bool    // 1904 date system
+		out      string  // ISO 8601 date
+	}{
+		{43617, false, "2019-06-01"},
+		{43617.5, false, "2019-06-01T12:00:00"},
+		{0.75, false, "18:00:00"},
+		{61, false, "1900-03-01"},
+		{42155, true, "2019-06-01"},
+	}
+
+	for _, tt := range serialTests {
+		if out := serialDate(tt.serial, tt.date1904); out != tt.out {
+			t.Errorf("serialDate(%v, %v): expected %v, got %v", tt.serial, tt.date1904, tt.out, out)
+		}
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	var formatTests = []struct {
+		code string // custom number format
+		date bool   // whether it shows a date
+	}{
+		{"yyyy-mm-dd", true},
+		{"[Red]dd/mm/yy", true},
+		{"hh:mm", true},
+		{"0.00", false},
+		{`0.0 "days"`, false},
+		{`[Red]#,##0`, false},
+		{`0\d`, false},
+	}
+
+	for _, tt := range formatTests {
+		if date := isDateFormat(tt.code); date != tt.date {
+			t.Errorf("isDateFormat(%q): expected %v, got %v", tt.code, tt.date, date)
+		}
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	var columnTests = []struct {
+		ref string // cell reference
+		col int    // zero-based column
+	}{
+		{"A1", 0},
+		{"Z9", 25},
+		{"AA10", 26},
+		{"AB1", 27},
+		{"", -1},
+	}
+
+	for _, tt := range columnTests {
+		if col := columnIndex(tt.ref); col != tt.col {
+			t.Errorf("columnIndex(%q): expected %v, got %v", tt.ref, tt.col, col)
+		}
+	}
+}
+
+// odsZip makes an ODS file in memory with the given table rows
+func odsZip(t *testing.T, rows string) *zip.Reader {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("content.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"><office:body><office:spreadsheet><table:table table:name="Sheet1">` + rows + `</table:table></office:spreadsheet></office:body></office:document-content>`))
+	w.Close()
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return z
+}
+
+func TestReadODS(t *testing.T) {
+	var odsTests = []struct {
+		rows  string // content of the table
+		count int    // rows read
+		width int    // cells in the last row
+		first string // first cell
+	}{
+		// a comment on a cell isn't part of its value
+		{`<table:table-row><table:table-cell><office:annotation><text:p>checked</text:p></office:annotation><text:p>Homo</text:p></table:table-cell></table:table-row>`,
+			1, 1, "Homo"},
+		// long runs of the same value are kept
+		{`<table:table-row table:number-rows-repeated="1500"><table:table-cell table:number-columns-repeated="1200"><text:p>x</text:p></table:table-cell></table:table-row>`,
+			1500, 1200, "x"},
+		// empty cells between values are kept, trailing ones capped
+		{`<table:table-row><table:table-cell><text:p>a</text:p></table:table-cell><table:table-cell table:number-columns-repeated="1200"/><table:table-cell><text:p>b</text:p></table:table-cell><table:table-cell table:number-columns-repeated="5000"/></table:table-row>`,
+			1, 1202 + maxRepeat, "a"},
+		// so are empty rows between rows with values, and trailing ones
+		{`<table:table-row><table:table-cell><text:p>a</text:p></table:table-cell></table:table-row><table:table-row table:number-rows-repeated="1200"><table:table-cell/></table:table-row><table:table-row><table:table-cell><text:p>b</text:p></table:table-cell></table:table-row><table:table-row table:number-rows-repeated="1048000"><table:table-cell table:number-columns-repeated="16384"/></table:table-row>`,
+			1202 + maxRepeat, maxRepeat, "a"},
+	}
+
+	for _, tt := range odsTests {
+		var rows [][]string
+		err := readODS(odsZip(t, tt.rows), func(string) bool { return true }, func(row []string) {
+			rows = append(rows, row)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != tt.count || len(rows[len(rows)-1]) != tt.width {
+			t.Errorf("readODS(%.60q...): expected %v rows ending with %v cells, got %v rows ending with %v", tt.rows, tt.count, tt.width, len(rows), len(rows[len(rows)-1]))
+			continue
+		}
+		if rows[0][0] != tt.first {
+			t.Errorf("readODS(%.60q...): expected first cell %q, got %q", tt.rows, tt.first, rows[0][0])
+		}
+	}
+}
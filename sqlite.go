@@ -0,0 +1,253 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// pure Go SQLite driver, so no C compiler is needed
+	_ "modernc.org/sqlite"
+)
+
+// Tables of the SQLite output
+const (
+	sqliteTable  = "occurrence"
+	mappingTable = "mapping"
+	stagingTable = "occurrence_import"
+)
+
+// identifierTerms are the terms that get an index in the SQLite
+// output, since they are what records are looked up by
+var identifierTerms = []string{"occurrenceID", "catalogNumber", "recordNumber", "otherCatalogNumbers", "eventID", "materialSampleID", "organismID", "locationID"}
+
+// Column types of the SQLite output, from the narrowest
+const (
+	typeNone    = "" // no values yet
+	typeInteger = "INTEGER"
+	typeReal    = "REAL"
+	typeDate    = "DATE"
+	typeText    = "TEXT"
+)
+
+// widenType returns the narrowest column type that holds both the
+// values seen so far, of type t, and value
+func widenType(t, value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" || t == typeText {
+		return t
+	}
+	v := typeText
+	if len(value) > 1 && value[0] == '0' && value[1] != '.' {
+		// leading zeros matter in codes like catalog numbers, and
+		// would be lost in a number
+	} else if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		v = typeInteger
+	} else if _, err := strconv.ParseFloat(value, 64); err == nil && !strings.ContainsAny(value, "nNiI") {
+		// leave out NaN and Inf, which are more likely words
+		v = typeReal
+	} else if _, err := time.Parse("2006-01-02", value); err == nil {
+		v = typeDate
+	}
+
+	switch {
+	case t == typeNone || t == v:
+		return v
+	case (t == typeInteger && v == typeReal) || (t == typeReal && v == typeInteger):
+		return typeReal
+	}
+	return typeText
+}
+
+// sqlName quotes a table or column name for SQL
+func sqlName(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqliteColumns returns the names of the SQLite columns for terms.
+// SQLite ignores case in column names, so a name that only differs in
+// case from an earlier one is numbered, like the repeated names of the
+// input (see fixHeader).
+func sqliteColumns(terms []string) []string {
+	taken := make(map[string]bool)
+	for _, term := range terms {
+		taken[strings.ToLower(term)] = true
+	}
+	var names []string
+	done := make(map[string]bool)
+	for _, term := range terms {
+		name := term
+		if done[strings.ToLower(term)] {
+			for n := 2; taken[strings.ToLower(name)]; n++ {
+				name = term + " (" + strconv.Itoa(n) + ")"
+			}
+		}
+		done[strings.ToLower(term)] = true
+		taken[strings.ToLower(name)] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// sqliteWriter inserts records into the staging table, keeping track
+// of the type of each column as it goes. It has the same Write method
+// as a csv.Writer, so convert can stream records into it.
+type sqliteWriter struct {
+	stmt  *sql.Stmt
+	types []string
+	args  []interface{}
+}
+
+func (sw *sqliteWriter) Write(record []string) error {
+	for i, value := range record {
+		sw.types[i] = widenType(sw.types[i], value)
+		if value == "" {
+			sw.args[i] = nil
+		} else {
+			sw.args[i] = value
+		}
+	}
+	_, err := sw.stmt.Exec(sw.args...)
+	return err
+}
+
+// writeSQLite streams the records in r, keeping the fields named by
+// index, into a new SQLite database at filename. header is the input's
+// header and terms the output columns, as returned by plan, and packed
+// the input columns packed into dynamicProperties (see packColumns). It
+// returns the number of records written.
+//
+// The records go into a staging table first, since the type of each
+// column is only known once every value has been seen; the typed
+// table is then filled from it.
+func writeSQLite(filename string, header, terms []string, r recordReader, index []int, packed []string) int {
+	fail := func(err error) {
+		fmt.Printf("Cannot write '%s': %s\n", filename, err.Error())
+		exit(1)
+	}
+
+	// build the database under a temporary name, like the other
+	// formats, so it only replaces the old one once it is complete
+	f := mustCreate(filename)
+	// SQLite keeps a journal next to the database during a transaction
+	journal := f.Name() + "-journal"
+	temporary[journal] = true
+	defer delete(temporary, journal)
+	db, err := sql.Open("sqlite", f.Name())
+	if err != nil {
+		fail(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		fail(err)
+	}
+
+	names := sqliteColumns(terms)
+	var columns, marks []string
+	for i, name := range names {
+		if name != terms[i] {
+			fmt.Printf("The column \"%v\" is called \"%v\" in the database, since SQLite column names ignore case\n", terms[i], name)
+		}
+		columns = append(columns, sqlName(name))
+		marks = append(marks, "?")
+	}
+	if _, err := tx.Exec("CREATE TABLE " + sqlName(stagingTable) + " (" + strings.Join(columns, ", ") + ")"); err != nil {
+		fail(err)
+	}
+	stmt, err := tx.Prepare("INSERT INTO " + sqlName(stagingTable) + " VALUES (" + strings.Join(marks, ", ") + ")")
+	if err != nil {
+		fail(err)
+	}
+	sw := &sqliteWriter{stmt: stmt, types: make([]string, len(terms)), args: make([]interface{}, len(terms))}
+	n := convert(r, sw, index)
+	stmt.Close()
+
+	// the typed table; SQLite converts the values to each column's type
+	var typed []string
+	for i, column := range columns {
+		if sw.types[i] == typeNone {
+			sw.types[i] = typeText
+		}
+		typed = append(typed, column+" "+sw.types[i])
+	}
+	statements := []string{
+		"CREATE TABLE " + sqlName(sqliteTable) + " (" + strings.Join(typed, ", ") + ")",
+		"INSERT INTO " + sqlName(sqliteTable) + " SELECT * FROM " + sqlName(stagingTable),
+		"DROP TABLE " + sqlName(stagingTable),
+	}
+	for i, term := range terms {
+		if Include(identifierTerms, term) {
+			statements = append(statements, "CREATE INDEX "+sqlName(sqliteTable+"_"+names[i])+" ON "+sqlName(sqliteTable)+" ("+sqlName(names[i])+")")
+		}
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			fail(err)
+		}
+	}
+
+	writeMapping(tx, mappingRows(header, names, index, packed, sw.types), fail)
+	if err := tx.Commit(); err != nil {
+		fail(err)
+	}
+	// reclaim the space the staging table took up
+	if _, err := db.Exec("VACUUM"); err != nil {
+		fail(err)
+	}
+	if err := db.Close(); err != nil {
+		fail(err)
+	}
+	mustClose(f)
+	return n
+}
+
+// mappingRows lists which input column each output column came from,
+// and then the input columns that were removed, as rows of position,
+// column name, type and source. The packed dynamicProperties column, which has
+// no input field of its own, lists the columns packed into it.
+func mappingRows(header, terms []string, index []int, packed []string, types []string) [][]interface{} {
+	var rows [][]interface{}
+	used := make(map[string]bool)
+	for _, source := range packed {
+		used[source] = true
+	}
+	for i, term := range terms {
+		source := strings.Join(packed, ", ")
+		if index[i] < len(header) {
+			source = header[index[i]]
+			used[source] = true
+		}
+		rows = append(rows, []interface{}{i + 1, term, types[i], source})
+	}
+	// removed columns have no position or term
+	for _, source := range header {
+		if !used[source] {
+			rows = append(rows, []interface{}{nil, nil, nil, source})
+		}
+	}
+	return rows
+}
+
+// writeMapping writes the rows of mappingRows to the mapping table
+func writeMapping(tx *sql.Tx, rows [][]interface{}, fail func(error)) {
+	if _, err := tx.Exec("CREATE TABLE " + sqlName(mappingTable) + ` (
+	"position" INTEGER,
+	"term" TEXT,
+	"type" TEXT,
+	"source" TEXT
+)`); err != nil {
+		fail(err)
+	}
+	stmt, err := tx.Prepare("INSERT INTO " + sqlName(mappingTable) + " VALUES (?, ?, ?, ?)")
+	if err != nil {
+		fail(err)
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			fail(err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWidenType(t *testing.T) {
+	var widenTests = []struct {
+		values []string // column values in order
+		t      string   // expected column type
+	}{
+		{[]string{"", ""}, typeNone},
+		{[]string{"12", "", "-3"}, typeInteger},
+		{[]string{"12", "3.5"}, typeReal},
+		{[]string{"0.25", "7"}, typeReal},
+		{[]string{"2019-06-01", "2020-01-31"}, typeDate},
+		{[]string{"2019-06-01", "12"}, typeText},
+		{[]string{"12", "femur"}, typeText},
+		{[]string{"007", "12"}, typeText},
+		{[]string{"NaN", "Inf"}, typeText},
+	}
+
+	for _, tt := range widenTests {
+		got := typeNone
+		for _, value := range tt.values {
+			got = widenType(got, value)
+		}
+		if got != tt.t {
+			t.Errorf("widenType(%q): expected %q, got %q", tt.values, tt.t, got)
+		}
+	}
+}
+
+func TestMappingRows(t *testing.T) {
+	dwc := []string{"occurrenceID", "dynamicProperties"}
+	header := []string{"ID", "Cutmarks", "Notes", "Notch"}
+	s := settings{remove: []string{"Notes"}, rename: [][]string{{"ID", "occurrenceID"}}}
+	var mappingTests = []struct {
+		header []string
+		want   string
+	}{
+		{header, `[[1,"occurrenceID","TEXT","ID"],[2,"dynamicProperties","TEXT","Cutmarks, Notch"],[null,null,null,"Notes"]]`},
+		// an existing dynamicProperties column is packed into too
+		{append(header, "dynamicProperties"), `[[1,"occurrenceID","TEXT","ID"],[2,"dynamicProperties","TEXT","dynamicProperties, Cutmarks, Notch"],[null,null,null,"Notes"]]`},
+	}
+
+	for _, tt := range mappingTests {
+		terms, index := s.plan(tt.header)
+		terms, index, _, packed := packColumns(tt.header, terms, index, nil, packCamel, dwc)
+		types := make([]string, len(terms))
+		for i := range types {
+			types[i] = typeText
+		}
+		result, _ := json.Marshal(mappingRows(tt.header, terms, index, packed, types))
+		if string(result) != tt.want {
+			t.Errorf("mappingRows(%v): expected %v, got %v", tt.header, tt.want, string(result))
+		}
+	}
+}
+
+func TestSQLiteColumns(t *testing.T) {
+	var columnTests = []struct {
+		terms, names []string
+	}{
+		{[]string{"occurrenceID", "year"}, []string{"occurrenceID", "year"}},
+		{[]string{"Year", "year", "YEAR"}, []string{"Year", "year (2)", "YEAR (3)"}},
+		{[]string{"year", "Year", "year (2)"}, []string{"year", "Year (3)", "year (2)"}},
+	}
+
+	for _, tt := range columnTests {
+		result, _ := json.Marshal(sqliteColumns(tt.terms))
+		expected, _ := json.Marshal(tt.names)
+		if string(result) != string(expected) {
+			t.Errorf("sqliteColumns(%v): expected %v, got %v", tt.terms, string(expected), string(result))
+		}
+	}
+}
+
+func TestWriteSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "DWCHelper-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "out.sqlite")
+
+	header := []string{"ID", "Catalog", "Depth", "When", "Year", "year", "Empty", "Notes"}
+	rows := [][]string{
+		{"1", "007", "1.5", "2019-06-01", "2019", "19", "", "x"},
+		{"2", "12", "", "2019-06-02", "2020", "20", "", "x"},
+	}
+	s := settings{remove: []string{"Notes"}, rename: [][]string{{"ID", "occurrenceID"}, {"Catalog", "catalogNumber"}}}
+	terms, index := s.plan(header)
+	if n := writeSQLite(filename, header, terms, &rowsReader{rows}, index, nil); n != 2 {
+		t.Errorf("writeSQLite: expected 2 records, got %v", n)
+	}
+
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	query := func(q string) string {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		columns, _ := rows.Columns()
+		var result []string
+		for rows.Next() {
+			values := make([]sql.NullString, len(columns))
+			pointers := make([]interface{}, len(columns))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+			rows.Scan(pointers...)
+			var fields []string
+			for _, v := range values {
+				if v.Valid {
+					fields = append(fields, v.String)
+				} else {
+					fields = append(fields, "NULL")
+				}
+			}
+			result = append(result, strings.Join(fields, "|"))
+		}
+		return strings.Join(result, "; ")
+	}
+
+	var queryTests = []struct {
+		query, want string
+	}{
+		// each column gets the narrowest type that fits, and leading
+		// zeros make a column text
+		{`SELECT name, type FROM pragma_table_info('occurrence')`,
+			"occurrenceID|INTEGER; catalogNumber|TEXT; Depth|REAL; When|DATE; Year|INTEGER; year (2)|INTEGER; Empty|TEXT"},
+		// empty values are NULL
+		{`SELECT occurrenceID, catalogNumber, Depth, Empty FROM occurrence`, "1|007|1.5|NULL; 2|12|NULL|NULL"},
+		{`SELECT typeof(occurrenceID), typeof(catalogNumber), typeof(Depth) FROM occurrence`, "integer|text|real; integer|text|null"},
+		{`SELECT name FROM sqlite_master WHERE type = 'index' ORDER BY name`, "occurrence_catalogNumber; occurrence_occurrenceID"},
+		{`SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name`, "mapping; occurrence"},
+		{`SELECT * FROM mapping`,
+			"1|occurrenceID|INTEGER|ID; 2|catalogNumber|TEXT|Catalog; 3|Depth|REAL|Depth; 4|When|DATE|When; 5|Year|INTEGER|Year; 6|year (2)|INTEGER|year; 7|Empty|TEXT|Empty; NULL|NULL|NULL|Notes"},
+	}
+	for _, tt := range queryTests {
+		if result := query(tt.query); result != tt.want {
+			t.Errorf("%v: expected %v, got %v", tt.query, tt.want, result)
+		}
+	}
+
+	// only the database is left, without temporary files
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected only %v in the folder, got %v files", filename, len(entries))
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// recordReader hands back one record at a time. *csv.Reader satisfies
+// it, which lets the conversion stream a file of any size instead of
+// holding every row in memory.
+type recordReader interface {
+	Read() ([]string, error)
+}
+
+// openInput opens the file at filename, which may be CSV or a
+// workbook, and returns its header along with a reader positioned at
+// the first data row. Records may not all be the same length; see
+// fitRows. The caller must close the returned io.Closer.
+func openInput(filename string, in inputDialect) (io.Closer, []string, recordReader) {
+	if isWorkbook(filename) {
+		rows, err := readSheet(filename, in.sheet)
+		if err != nil {
+			fmt.Printf("Cannot read '%s': %s\n", filename, err.Error())
+			exit(1)
+		}
+		if len(rows) == 0 {
+			fmt.Printf("Sheet '%s' of '%s' is empty\n", in.sheet, filename)
+			exit(1)
+		}
+		rr := &rowsReader{rows}
+		return noClose{}, readHeader(rr, in), rr
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		fmt.Printf("Cannot open '%s': %s\n", filename, err.Error())
+		exit(1)
+	}
+
+	var src io.Reader = decodeInput(f, in.encoding)
+	if in.quote == '\'' {
+		src = swapQuotes{src}
+	}
+	r := csv.NewReader(src)
+	r.LazyQuotes = true
+	r.ReuseRecord = true
+	r.FieldsPerRecord = -1
+	if in.delimiter != 0 {
+		r.Comma = in.delimiter
+	}
+	var rr recordReader = r
+	if in.quote == '\'' {
+		rr = unswapQuotes{r}
+	}
+
+	return f, readHeader(rr, in), rr
+}
+
+// readHeader skips any preamble before the header and reads the
+// header, joining it into one row of names if it takes up several
+// rows
+func readHeader(r recordReader, in inputDialect) []string {
+	row, rows := in.headerRow, in.headerRows
+	if row < 1 {
+		row = 1
+	}
+	if rows < 1 || rows > row {
+		rows = 1
+	}
+
+	var headerRows [][]string
+	for i := 1; i <= row; i++ {
+		record, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("there are only %v rows", i-1)
+			}
+			fmt.Println("Cannot read CSV header:", err.Error())
+			exit(1)
+		}
+		if i > row-rows {
+			// the reader reuses its backing array, so keep our own copy
+			headerRows = append(headerRows, append([]string(nil), record...))
+		}
+	}
+	return joinHeaderRows(headerRows)
+}
+
+// raggedReader makes every record the same length as the header,
+// which a stray quote in a remarks field can upset. Depending on the
+// strategy, short rows are padded with empty fields ("pad"), long rows
+// lose their extra fields ("truncate"), and any other ragged row is
+// quarantined in a rejects file.
+type raggedReader struct {
+	r        recordReader
+	width    int         // number of fields in the header
+	strategy string      // pad, truncate or reject
+	rejects  string      // file for quarantined rows
+	w        *csv.Writer // writer for the rejects file, opened when needed
+	f        *atomicFile
+	header   []string
+	n        int // records read so far
+	fixed    int // rows padded or truncated
+	rejected int // rows quarantined
+}
+
+// maxRaggedReports is how many ragged rows are reported one by one
+const maxRaggedReports = 10
+
+// raggedStrategies are the accepted values for -ragged
+var raggedStrategies = []string{"pad", "truncate", "reject"}
+
+// fitRows wraps r so that every record matches the header. Rows that
+// can't be fixed with the given strategy go to the rejects file, with
+// their line number in front. If rejects is empty nothing is reported
+// and those rows are simply skipped, which is what summarize wants for
+// its first look at the data.
+func fitRows(r recordReader, header []string, strategy, rejects string) *raggedReader {
+	if strategy == "" {
+		strategy = "pad"
+	}
+	return &raggedReader{r: r, width: len(header), strategy: strategy, rejects: rejects, header: header}
+}
+
+func (rr *raggedReader) Read() ([]string, error) {
+	for {
+		record, err := rr.r.Read()
+		if err != nil {
+			return record, err
+		}
+		rr.n++
+		switch {
+		case len(record) == rr.width:
+			return record, nil
+		case len(record) < rr.width && rr.strategy == "pad":
+			rr.report(record, "padded with empty fields")
+			for len(record) < rr.width {
+				record = append(record, "")
+			}
+			rr.fixed++
+			return record, nil
+		case len(record) > rr.width && rr.strategy == "truncate":
+			rr.report(record, "extra fields dropped")
+			rr.fixed++
+			return record[:rr.width], nil
+		}
+		rr.report(record, "moved to "+rr.rejects)
+		rr.reject(record)
+	}
+}
+
+// line returns the line number of the record just read, if the
+// underlying reader knows it, or else its position in the file
+func (rr *raggedReader) line() int {
+	if p, ok := rr.r.(interface{ FieldPos(int) (int, int) }); ok {
+		line, _ := p.FieldPos(0)
+		return line
+	}
+	// the header is the first row
+	return rr.n + 1
+}
+
+// report tells the user about a ragged row
+func (rr *raggedReader) report(record []string, action string) {
+	if rr.rejects == "" {
+		return
+	}
+	if rr.fixed+rr.rejected < maxRaggedReports {
+		fmt.Printf("Line %v has %v fields instead of %v: %v\n", rr.line(), len(record), rr.width, action)
+	} else if rr.fixed+rr.rejected == maxRaggedReports {
+		fmt.Println("More rows have the wrong number of fields; see the summary at the end...")
+	}
+}
+
+// reject writes a record to the rejects file
+func (rr *raggedReader) reject(record []string) {
+	rr.rejected++
+	if rr.rejects == "" {
+		return
+	}
+	if rr.w == nil {
+		f, err := createFile(rr.rejects)
+		if err != nil {
+			fmt.Printf("Cannot save rejected rows to '%s': %s\n", rr.rejects, err.Error())
+			exit(1)
+		}
+		rr.f = f
+		rr.w = csv.NewWriter(f)
+		rr.w.Write(append([]string{"line"}, rr.header...))
+	}
+	rr.w.Write(append([]string{strconv.Itoa(rr.line())}, record...))
+}
+
+// Close finishes the rejects file and sums up what happened to
+// ragged rows
+func (rr *raggedReader) Close() error {
+	if rr.rejects != "" && rr.fixed+rr.rejected > 0 {
+		fmt.Printf("%v rows had the wrong number of fields: %v fixed (-ragged %v), %v moved to %v\n",
+			rr.fixed+rr.rejected, rr.fixed, rr.strategy, rr.rejected, rr.rejects)
+	}
+	if rr.w == nil {
+		return nil
+	}
+	rr.w.Flush()
+	if err := rr.w.Error(); err != nil {
+		rr.f.Close()
+		return err
+	}
+	return rr.f.Close()
+}
+
+// plan works out the output header for the given input header after
+// the removals and renames in s, along with the index of the input
+// field that fills each output column. Removals are applied before
+// renames, in the order they appear in s.
+func (s settings) plan(header []string) ([]string, []int) {
+	terms := append([]string{}, header...)
+	index := make([]int, len(terms))
+	for i := range index {
+		index[i] = i
+	}
+
+	for _, term := range s.remove {
+		keptTerms := []string{}
+		keptIndex := []int{}
+		for i, t := range terms {
+			if t != term {
+				keptTerms = append(keptTerms, t)
+				keptIndex = append(keptIndex, index[i])
+			}
+		}
+		terms, index = keptTerms, keptIndex
+	}
+
+	for _, row := range s.rename {
+		terms = Rename(terms, row[0], row[1])
+	}
+	return terms, index
+}
+
+// columns works out the output columns for header like plan, then
+// packs and orders them as the output dialect of s says. Packing adds
+// a field to each record, so r comes back wrapped if needed, and
+// packed lists the input columns packed into it (see packColumns).
+// dwc is the list of Darwin Core terms.
+func (s settings) columns(header []string, r recordReader, dwc []string) ([]string, []int, recordReader, []string) {
+	terms, index := s.plan(header)
+	var packed []string
+	if s.output.pack != "" && s.output.pack != packOff {
+		terms, index, r, packed = packColumns(header, terms, index, r, s.output.pack, dwc)
+	}
+	if s.output.order == orderDWC || s.output.order == orderDWCOnly {
+		terms, index = orderColumns(terms, index, s.output.order, dwc)
+	}
+	return terms, index, r, packed
+}
+
+// recordWriter is where convert writes records: a *csv.Writer, or one
+// of the other output formats
+type recordWriter interface {
+	Write(record []string) error
+}
+
+// convert reads every record from r and writes the fields named by
+// index to w, one record at a time. It returns the number of records
+// written.
+func convert(r recordReader, w recordWriter, index []int) int {
+	out := make([]string, len(index))
+	n := 0
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Println("Cannot read CSV data:", err.Error())
+			exit(1)
+		}
+		for i, j := range index {
+			out[i] = strings.ToValidUTF8(record[j], "\uFFFD")
+		}
+		// a record that can't be written would be missing from the
+		// output, yet counted
+		if err := w.Write(out); err != nil {
+			fmt.Println("Cannot write record", n+1, "to the output:", err.Error())
+			exit(1)
+		}
+		n++
+	}
+	return n
+}
+
+// exportDB streams the records in r to the file at filename,
+// applying the removals and renames in s along the way. format is
+// one of outputFormats, or empty to go by the file extension. The
+// output is always UTF-8. dwc is the list of Darwin Core terms.
+func exportDB(filename, format string, header []string, r recordReader, s settings, dwc []string) {
+	terms, index, r, packed := s.columns(header, r, dwc)
+
+	// work out the coverage of the data for the dataset metadata
+	var cov *coverage
+	if s.meta.title != "" {
+		cov = &coverage{}
+		r = cov.watch(r, terms, index)
+	}
+
+	var n int
+	switch formatFor(filename, format) {
+	case "dwca":
+		n = writeArchive(filename, terms, r, index, s.output, s.meta, cov, dwc)
+	case "sqlite":
+		n = writeSQLite(filename, header, terms, r, index, packed)
+	case "turtle", "ntriples", "jsonld":
+		n = writeRDF(filename, formatFor(filename, format), terms, r, index, s.namespace, dwc)
+	default:
+		f, w := createCSV(filename, s.output)
+		w.Write(s.output.header(terms)) // first line contains the terms in order
+		n = convert(r, w, index)
+		finishCSV(filename, w)
+		mustClose(f)
+	}
+	fmt.Printf("Wrote %v records to %v\n", n, filename)
+
+	if cov != nil && formatFor(filename, format) != "dwca" {
+		writeEML(strings.TrimSuffix(filename, filepath.Ext(filename))+".eml.xml", s.meta, cov)
+	}
+}
+
+// outputFormats are the accepted values for -format
+var outputFormats = append([]string{"csv", "dwca", "sqlite"}, rdfFormats...)
+
+// formatFor returns the output format to use for filename: format
+// itself if it is given, or else the one its extension suggests
+func formatFor(filename, format string) string {
+	if format != "" {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".zip":
+		return "dwca"
+	case ".sqlite", ".sqlite3", ".db":
+		return "sqlite"
+	case ".ttl":
+		return "turtle"
+	case ".nt":
+		return "ntriples"
+	case ".jsonld":
+		return "jsonld"
+	}
+	return "csv"
+}
+
+// createCSV creates the output file at filename and a CSV writer for
+// it, writing the byte order mark if the dialect has one. The file
+// only appears under its name once it is closed.
+func createCSV(filename string, out outputDialect) (*atomicFile, *csvWriter) {
+	f := mustCreate(filename)
+	w := newCSVWriter(f, out)
+	if out.bom {
+		w.w.Write(bomUTF8)
+	}
+	return f, w
+}
+
+// finishCSV flushes w, giving up if anything couldn't be written
+func finishCSV(filename string, w *csvWriter) {
+	if err := w.Flush(); err != nil {
+		fmt.Printf("Cannot write '%s': %s\n", filename, err.Error())
+		exit(1)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	var planTests = []struct {
+		header []string // input header
+		s      settings // removals and renames
+		terms  []string // output header
+		index  []int    // input field for each output column
+	}{
+		{[]string{"a", "b", "c"}, settings{}, []string{"a", "b", "c"}, []int{0, 1, 2}},
+		{[]string{"a", "b", "c"}, settings{remove: []string{"b"}}, []string{"a", "c"}, []int{0, 2}},
+		{[]string{"a", "b", "c"}, settings{remove: []string{"x"}}, []string{"a", "b", "c"}, []int{0, 1, 2}},
+		{[]string{"a", "b", "c"}, settings{rename: [][]string{{"c", "x"}}}, []string{"a", "b", "x"}, []int{0, 1, 2}},
+		{[]string{"a", "b", "c"}, settings{remove: []string{"a"}, rename: [][]string{{"b", "x"}}}, []string{"x", "c"}, []int{1, 2}},
+		{[]string{"a", "b", "c"}, settings{remove: []string{"a", "b", "c"}}, []string{}, []int{}},
+	}
+
+	for _, tt := range planTests {
+		terms, index := tt.s.plan(tt.header)
+		result, _ := json.Marshal([]interface{}{terms, index})
+		expected, _ := json.Marshal([]interface{}{tt.terms, tt.index})
+		if string(result) != string(expected) {
+			t.Errorf("plan(%v) with %+v: expected %v, got %v", tt.header, tt.s, string(expected), string(result))
+		}
+	}
+}
+
+func TestFitRows(t *testing.T) {
+	rows := [][]string{{"1", "2"}, {"3"}, {"4", "5", "6"}}
+	var fitTests = []struct {
+		strategy string     // what to do with ragged rows
+		out      [][]string // rows that come through
+	}{
+		{"pad", [][]string{{"1", "2"}, {"3", ""}}},
+		{"truncate", [][]string{{"1", "2"}, {"4", "5"}}},
+		{"reject", [][]string{{"1", "2"}}},
+	}
+
+	for _, tt := range fitTests {
+		r := fitRows(&rowsReader{append([][]string(nil), rows...)}, []string{"a", "b"}, tt.strategy, "")
+		var out [][]string
+		for {
+			row, err := r.Read()
+			if err != nil {
+				break
+			}
+			out = append(out, row)
+		}
+		result, _ := json.Marshal(out)
+		expected, _ := json.Marshal(tt.out)
+		if string(result) != string(expected) {
+			t.Errorf("fitRows with %v: expected %v, got %v", tt.strategy, string(expected), string(result))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkSettings looks for entries in s that don't do what they seem
+// to with an input whose columns are header: removals and renames
+// that match no column, renames to names that aren't Darwin Core
+// terms dwc, columns that are both removed and renamed, and columns
+// that would end up with the same name. It returns one line for each
+// problem, in the order plan meets them.
+func checkSettings(header []string, s settings, dwc []string) []string {
+	var problems []string
+	for _, term := range s.remove {
+		if !Include(header, term) {
+			problems = append(problems, fmt.Sprintf("\"%v\" is removed, but there is no such column", term))
+		}
+	}
+
+	// follow the renames as plan does, remembering where each column
+	// came from
+	var terms []string
+	for _, t := range header {
+		if !Include(s.remove, t) {
+			terms = append(terms, t)
+		}
+	}
+	from := append([]string{}, terms...)
+	for _, row := range s.rename {
+		switch {
+		case Include(s.remove, row[0]):
+			problems = append(problems, fmt.Sprintf("\"%v\" is both removed and renamed to \"%v\"; it is removed", row[0], row[1]))
+			continue
+		case !Include(terms, row[0]):
+			problems = append(problems, fmt.Sprintf("\"%v\" is renamed to \"%v\", but there is no such column", row[0], row[1]))
+			continue
+		}
+		terms = Rename(terms, row[0], row[1])
+	}
+	for i, term := range terms {
+		if term != from[i] && termIRI(term, dwc) == "" {
+			problems = append(problems, fmt.Sprintf("\"%v\" is renamed to \"%v\", which isn't a Darwin Core term", from[i], term))
+		}
+	}
+
+	var reported []string
+	for i, term := range terms {
+		if Include(reported, term) {
+			continue
+		}
+		sources := []string{from[i]}
+		for j := i + 1; j < len(terms); j++ {
+			if terms[j] == term {
+				sources = append(sources, from[j])
+			}
+		}
+		if len(sources) > 1 {
+			reported = append(reported, term)
+			problems = append(problems, fmt.Sprintf("%v columns would be called \"%v\": %v", len(sources), term, strings.Join(sources, ", ")))
+		}
+	}
+	return problems
+}
+
+// reportSettings prints the problems checkSettings finds with the
+// settings of one input, and returns true if there are any
+func reportSettings(filename string, header []string, s settings, dwc []string) bool {
+	problems := checkSettings(header, s, dwc)
+	if len(problems) == 0 {
+		return false
+	}
+	fmt.Printf("Some of the settings in %v don't fit the input:\n", filename)
+	for _, p := range problems {
+		fmt.Println("  " + p)
+	}
+	fmt.Println()
+	return true
+}
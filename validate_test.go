@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCheckSettings(t *testing.T) {
+	dwc := []string{"occurrenceID", "locality", "decimalLatitude"}
+	header := []string{"ID", "Site", "Lat", "Notes"}
+	var checkTests = []struct {
+		remove []string
+		rename [][]string
+		out    []string
+	}{
+		{[]string{"Notes"}, [][]string{{"ID", "occurrenceID"}, {"Site", "locality"}, {"Lat", "Lat"}}, nil},
+		{[]string{"Note"}, [][]string{{"Site", "locality"}}, []string{
+			`"Note" is removed, but there is no such column`,
+		}},
+		{nil, [][]string{{"Sites", "locality"}, {"Lat", "latitude"}}, []string{
+			`"Sites" is renamed to "locality", but there is no such column`,
+			`"Lat" is renamed to "latitude", which isn't a Darwin Core term`,
+		}},
+		{[]string{"Notes"}, [][]string{{"Notes", "locality"}}, []string{
+			`"Notes" is both removed and renamed to "locality"; it is removed`,
+		}},
+		{nil, [][]string{{"Site", "locality"}, {"Notes", "locality"}, {"ID", "Lat"}}, []string{
+			`"ID" is renamed to "Lat", which isn't a Darwin Core term`,
+			`2 columns would be called "Lat": ID, Lat`,
+			`2 columns would be called "locality": Site, Notes`,
+		}},
+		// a chain of renames is followed
+		{nil, [][]string{{"Site", "Locality"}, {"Locality", "locality"}}, nil},
+	}
+
+	for _, tt := range checkTests {
+		s := settings{remove: tt.remove, rename: tt.rename}
+		result, _ := json.Marshal(checkSettings(header, s, dwc))
+		expected, _ := json.Marshal(tt.out)
+		if string(result) != string(expected) {
+			t.Errorf("checkSettings(%v, %v): expected %v, got %v", tt.remove, tt.rename, string(expected), string(result))
+		}
+	}
+}